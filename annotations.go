@@ -0,0 +1,233 @@
+package confflags
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Annotation is a piece of metadata attached to a flag with Annotate, which
+// changes how confflags treats the flag.  Keys other than those used by the
+// functions below are ignored by confflags, and may be used by programs for
+// their own metadata.
+type Annotation struct {
+	Key   string
+	Value string
+}
+
+/* Keys for the annotations confflags understands */
+const (
+	secretKey          = "secret"
+	categoryKey        = "category"
+	restartRequiredKey = "restartRequired"
+	placeholderKey     = "placeholder"
+	hiddenKey          = "hidden"
+	immutableKey       = "immutable"
+	credentialKey      = "credential"
+)
+
+/* Annotations, by flag name then key */
+type annotationState struct {
+	annotations    map[string]map[string]string
+	categoryOrder  []string /* In order of first use */
+	annotationLock sync.Mutex
+}
+
+func (s *annotationState) init() {
+	s.annotations = make(map[string]map[string]string)
+}
+
+// Annotate attaches annotations to the named flag in flag.CommandLine,
+// replacing any previous annotations with the same keys.
+func Annotate(name string, anns ...Annotation) error {
+	return std.Annotate(name, anns...)
+}
+
+// Annotate attaches annotations to the named flag, replacing any previous
+// annotations with the same keys.
+func (cf *ConfFlags) Annotate(name string, anns ...Annotation) error {
+	if cf.parsed {
+		if err := cf.verifyFlagChangeFlagName(name); nil != err {
+			return err
+		}
+	}
+	cf.annotationLock.Lock()
+	defer cf.annotationLock.Unlock()
+	a, ok := cf.annotations[name]
+	if !ok {
+		a = make(map[string]string)
+		cf.annotations[name] = a
+	}
+	for _, ann := range anns {
+		a[ann.Key] = ann.Value
+		if categoryKey == ann.Key {
+			cf.noteCategory(ann.Value)
+		}
+	}
+	return nil
+}
+
+// Annotations returns a copy of the annotations attached to the named flag
+// in flag.CommandLine, by key.
+func Annotations(name string) map[string]string {
+	return std.Annotations(name)
+}
+
+// Annotations returns a copy of the annotations attached to the named flag,
+// by key.
+func (cf *ConfFlags) Annotations(name string) map[string]string {
+	cf.annotationLock.Lock()
+	defer cf.annotationLock.Unlock()
+	a := make(map[string]string)
+	for k, v := range cf.annotations[name] {
+		a[k] = v
+	}
+	return a
+}
+
+// Secret marks a flag's value as secret.  Secret values are replaced with
+// ***** by -dumpflags, or with a placeholder if the flag has one, and with
+// ***** in UpdateResults, Changes, and webhook payloads.
+func Secret() Annotation {
+	return Annotation{secretKey, "true"}
+}
+
+// Sensitive is the same as Secret.
+func Sensitive() Annotation {
+	return Secret()
+}
+
+// MarkSensitive marks the named flag in flag.CommandLine as sensitive, e.g. a
+// password, so its value isn't leaked by dumps or change reports.  It's the
+// same as annotating the flag with Secret.
+func MarkSensitive(name string) error {
+	return std.MarkSensitive(name)
+}
+
+// MarkSensitive marks the named flag as sensitive.  See the package-level
+// MarkSensitive.
+func (cf *ConfFlags) MarkSensitive(name string) error {
+	return cf.Annotate(name, Secret())
+}
+
+// Placeholder sets the name of the environment variable or other secret
+// binding which provides a secret flag's value.  -dumpflags writes the
+// flag's value as ${name}, so that the dump can be used as a template.  When
+// the dump is read as config, ${name} is replaced with the value of the
+// environment variable name, unless there's a flag called name.
+func Placeholder(name string) Annotation {
+	return Annotation{placeholderKey, name}
+}
+
+// Category puts a flag in the named category, which is used as its group by
+// PrintGroupedDefaults.
+func Category(name string) Annotation {
+	return Annotation{categoryKey, name}
+}
+
+// Group is the same as Category.
+func Group(name string) Annotation {
+	return Category(name)
+}
+
+// Hidden hides a flag from PrintGroupedDefaults and -dumpflags, e.g. for
+// flags meant only for debugging.  The flag may still be set as usual.
+func Hidden() Annotation {
+	return Annotation{hiddenKey, "true"}
+}
+
+// RestartRequired marks a flag as one whose changes only take effect when the
+// program is restarted.  This is noted in usage messages and by -dumpflags.
+// When the flag is changed by re-reading the config, its callbacks aren't
+// called, and it's listed in UpdateResult.RestartRequired.
+func RestartRequired() Annotation {
+	return Annotation{restartRequiredKey, "true"}
+}
+
+// annotation returns the value of the named flag's annotation with the given
+// key, or "" if it has none
+func (s *annotationState) annotation(name, key string) string {
+	s.annotationLock.Lock()
+	defer s.annotationLock.Unlock()
+	return s.annotations[name][key]
+}
+
+// isAnnotated reports whether the named flag's annotation with the given key
+// is set to true
+func (s *annotationState) isAnnotated(name, key string) bool {
+	return "true" == s.annotation(name, key)
+}
+
+// noteCategory adds c to categoryOrder if it's not already there.
+// annotationLock must be held.
+func (s *annotationState) noteCategory(c string) {
+	for _, o := range s.categoryOrder {
+		if o == c {
+			return
+		}
+	}
+	s.categoryOrder = append(s.categoryOrder, c)
+}
+
+// Immutable marks a flag as one which may only be set at startup, e.g. an
+// address on which to listen.  When the config is re-read, changes to the
+// flag are ignored, with a Warning for each config line which would have
+// changed it, and the flag is listed in UpdateResult.Ignored.
+func Immutable() Annotation {
+	return Annotation{immutableKey, "true"}
+}
+
+// splitRestartRequired returns the sorted names of the flags in vals
+// annotated with RestartRequired, and the values of the others
+func (s *annotationState) splitRestartRequired(
+	vals map[string]string) ([]string, map[string]string) {
+	var restart []string
+	others := make(map[string]string)
+	for k, v := range vals {
+		if s.isAnnotated(k, restartRequiredKey) {
+			restart = append(restart, k)
+		} else {
+			others[k] = v
+		}
+	}
+	sort.Strings(restart)
+	return restart, others
+}
+
+/* usageNote returns extra text for the named flag's usage message */
+func (s *annotationState) usageNote(name string) string {
+	if s.isAnnotated(name, restartRequiredKey) {
+		return " (restart required)"
+	}
+	return ""
+}
+
+/* redactValue returns v, or ***** if the named flag is secret */
+func (s *annotationState) redactValue(name, v string) string {
+	if s.isAnnotated(name, secretKey) {
+		return "*****"
+	}
+	return v
+}
+
+// redactErr returns err, or, if the flag name is a secret, an error which
+// doesn't say what err said, as it may include the value
+func (s *annotationState) redactErr(name string, err error) error {
+	if s.isAnnotated(name, secretKey) {
+		return errors.New("invalid value")
+	}
+	return err
+}
+
+/* redactValues returns a copy of vals with secret values replaced */
+func (s *annotationState) redactValues(
+	vals map[string]string) map[string]string {
+	if nil == vals {
+		return nil
+	}
+	r := make(map[string]string)
+	for k, v := range vals {
+		r[k] = s.redactValue(k, v)
+	}
+	return r
+}
@@ -0,0 +1,69 @@
+package confflags
+
+import "flag"
+
+// Appender is implemented by flag.Values which hold lists and the like.
+// Values for such a flag from the config file are each given to Append, in
+// order, after Reset, so a key given on several lines, e.g.
+//
+//	allow-ip 10.0.0.0/8
+//	allow-ip 192.168.0.0/16
+//
+// sets the flag to all of the values, not just the last.  Values from the
+// command line, the environment, and so on are still given to Set, and
+// replace any from the config file.  Lines in a [tenant:namespace] section
+// replace those outside of one.
+type Appender interface {
+	Resettable
+	Append(v string) error
+}
+
+/* isAppender reports whether f's Value is an Appender */
+func isAppender(f *flag.Flag) bool {
+	if nil == f {
+		return false
+	}
+	_, ok := f.Value.(Appender)
+	return ok
+}
+
+// collectLists returns args with only the last line for each flag whose
+// Value is an Appender, and, by that last line, the lines in the same
+// namespace which set the flag, in order
+func (cf *ConfFlags) collectLists(args []Arg) ([]Arg, map[Arg][]Arg) {
+	last := make(map[string]Arg)
+	for _, arg := range args {
+		last[arg.Key] = arg
+	}
+	var out []Arg
+	lists := make(map[Arg][]Arg)
+	for _, arg := range args {
+		l := last[arg.Key]
+		if l.Namespace != arg.Namespace ||
+			!isAppender(cf.fs.Lookup(arg.Key)) {
+			out = append(out, arg)
+			continue
+		}
+		lists[l] = append(lists[l], arg)
+		if arg == l {
+			out = append(out, arg)
+		}
+	}
+	return out, lists
+}
+
+// set sets the staged flag to its new value, or, if it has a list of
+// values, appends each to it after resetting it
+func (s stagedFlag) set() error {
+	if nil == s.vs {
+		return setFlagValue(s.f, s.v)
+	}
+	a := s.f.Value.(Appender)
+	a.Reset()
+	for _, v := range s.vs {
+		if err := a.Append(v); nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package confflags
+
+import "sort"
+
+// ApplyMap sets the flags named by the keys in values to the corresponding
+// values as if they had been read from the config file, e.g. for config
+// received over RPC.  Flags set on the command line are left alone,
+// callbacks are called, Generation is incremented, and children registered
+// with AddChild are signalled.  Unlike reading the config file, flags not in
+// values are left unchanged.  If any value can't be set, none are set and
+// the returned UpdateResult's Err is set.  Values are used as they are, so
+// @path, ${name}, and other references aren't resolved.  The next read of
+// the config file replaces values set with ApplyMap.
+func ApplyMap(values map[string]string) UpdateResult {
+	return std.ApplyMap(values)
+}
+
+// ApplyMap sets flags in cf's FlagSet as if they had been read from the
+// config file.  See the package-level ApplyMap.
+func (cf *ConfFlags) ApplyMap(values map[string]string) UpdateResult {
+	/* Sorted, for repeatable error messages */
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]Arg, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, Arg{
+			Key:      k,
+			Value:    values[k],
+			FilePath: "ApplyMap",
+			kind:     argLiteral,
+		})
+	}
+
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	return cf.finishUpdate(cf.applyArgs(args, false))
+}
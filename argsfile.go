@@ -0,0 +1,104 @@
+package confflags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// expandArgsFiles replaces each argument of the form @file in args with the
+// arguments in file, which are separated by whitespace and may be quoted with
+// ' or ", and may themselves include @file arguments.  A # at the start of an
+// argument starts a comment which runs to the end of the line.  An argument
+// starting with @@ is passed on with the first @ removed.  Arguments after --
+// are passed on unchanged.  stack holds the files being expanded.
+func expandArgsFiles(args []string, stack []string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	for i, arg := range args {
+		switch {
+		case "--" == arg:
+			return append(out, args[i:]...), nil
+		case strings.HasPrefix(arg, "@@"):
+			out = append(out, arg[1:])
+		case strings.HasPrefix(arg, "@") && 1 < len(arg):
+			fargs, err := readArgsFile(arg[1:], stack)
+			if nil != err {
+				return nil, err
+			}
+			out = append(out, fargs...)
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out, nil
+}
+
+/* readArgsFile returns the expanded arguments in the file at path */
+func readArgsFile(path string, stack []string) ([]string, error) {
+	/* Don't go round in circles */
+	for _, s := range stack {
+		if filepath.Clean(s) == filepath.Clean(path) {
+			return nil, fmt.Errorf("arguments file %v includes "+
+				"itself", path)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	args, err := splitArgs(string(b))
+	if nil != err {
+		return nil, fmt.Errorf("unable to read arguments from %v: %v",
+			path, err)
+	}
+	return expandArgsFiles(args, append(stack, path))
+}
+
+/* splitArgs splits s into arguments the way a simple shell would */
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool /* In the middle of an argument */
+		quote   rune /* Quote character, if in quotes */
+		escaped bool /* Last character was a backslash */
+		comment bool /* In a comment */
+	)
+	for _, c := range s {
+		switch {
+		case comment:
+			comment = '\n' != c
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case '\\' == c && '\'' != quote:
+			escaped, inArg = true, true
+		case 0 != quote && c == quote:
+			quote = 0
+		case 0 != quote:
+			cur.WriteRune(c)
+		case '\'' == c || '"' == c:
+			quote, inArg = c, true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case '#' == c && !inArg:
+			comment = true
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if 0 != quote {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,272 @@
+package confflags
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWS is reached without the AWS SDK.  Credentials come from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+// environment variables or, failing that, the EC2 instance's role.  The
+// region comes from AWS_REGION, AWS_DEFAULT_REGION, or the EC2 instance.
+// AWS_ENDPOINT_URL_<SERVICE> or AWS_ENDPOINT_URL replace the usual endpoint,
+// e.g. for a VPC endpoint or a local test server.
+
+/* awsMetadataURL is where EC2's instance metadata is served */
+const awsMetadataURL = "http://169.254.169.254"
+
+/* awsCreds are credentials for signing AWS requests */
+type awsCreds struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+/* Instance role credentials, cached until shortly before they expire */
+var (
+	awsInstanceCreds awsCreds
+	awsCredsLock     sync.Mutex
+)
+
+/* awsCredentials returns credentials from the environment or instance */
+func awsCredentials() (awsCreds, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); "" != id {
+		return awsCreds{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	awsCredsLock.Lock()
+	defer awsCredsLock.Unlock()
+	if "" != awsInstanceCreds.AccessKeyID &&
+		time.Now().Add(5*time.Minute).Before(
+			awsInstanceCreds.Expiration) {
+		return awsInstanceCreds, nil
+	}
+	role, err := awsMetadata("/latest/meta-data/iam/security-credentials/")
+	if nil != err {
+		return awsCreds{}, fmt.Errorf("no AWS credentials in the "+
+			"environment or from the instance: %v", err)
+	}
+	b, err := awsMetadata("/latest/meta-data/iam/security-credentials/" +
+		strings.TrimSpace(strings.SplitN(role, "\n", 2)[0]))
+	if nil != err {
+		return awsCreds{}, err
+	}
+	var c awsCreds
+	if err := json.Unmarshal([]byte(b), &c); nil != err {
+		return awsCreds{}, fmt.Errorf("unable to decode instance "+
+			"credentials: %v", err)
+	}
+	awsInstanceCreds = c
+	return c, nil
+}
+
+/* awsRegion returns the region from the environment or instance */
+func awsRegion() (string, error) {
+	for _, v := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(v); "" != r {
+			return r, nil
+		}
+	}
+	r, err := awsMetadata("/latest/meta-data/placement/region")
+	if nil != err {
+		return "", fmt.Errorf("no AWS region in the environment or "+
+			"from the instance: %v", err)
+	}
+	return strings.TrimSpace(r), nil
+}
+
+/* awsMetadata gets path from the instance metadata service, using IMDSv2 */
+func awsMetadata(path string) (string, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	req, err := http.NewRequest(http.MethodPut,
+		awsMetadataURL+"/latest/api/token", nil)
+	if nil != err {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := awsMetadataDo(client, req)
+	if nil != err {
+		return "", err
+	}
+	if req, err = http.NewRequest(http.MethodGet, awsMetadataURL+path,
+		nil); nil != err {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return awsMetadataDo(client, req)
+}
+
+/* awsMetadataDo makes a request to the metadata service */
+func awsMetadataDo(client *http.Client, req *http.Request) (string, error) {
+	res, err := client.Do(req)
+	if nil != err {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		return "", err
+	}
+	if http.StatusOK != res.StatusCode {
+		return "", fmt.Errorf("unexpected status %q from %v",
+			res.Status, req.URL)
+	}
+	return string(b), nil
+}
+
+/* awsEndpoint returns the URL for service in region */
+func awsEndpoint(service, region string) string {
+	for _, v := range []string{"AWS_ENDPOINT_URL_" + strings.ToUpper(
+		service), "AWS_ENDPOINT_URL"} {
+		if u := os.Getenv(v); "" != u {
+			return strings.TrimRight(u, "/") + "/"
+		}
+	}
+	return fmt.Sprintf("https://%v.%v.amazonaws.com/", service, region)
+}
+
+// awsCall calls the action of an AWS service which speaks the JSON 1.1
+// protocol, such as SSM and Secrets Manager, in region, decoding the
+// response into res.  target is the X-Amz-Target prefix, e.g. AmazonSSM.
+func awsCall(service, region, target, action string, req,
+	res interface{}) error {
+	body, err := json.Marshal(req)
+	if nil != err {
+		return err
+	}
+	creds, err := awsCredentials()
+	if nil != err {
+		return err
+	}
+	hr, err := http.NewRequest(http.MethodPost, awsEndpoint(service,
+		region), bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	hr.Header.Set("X-Amz-Target", target+"."+action)
+	awsSign(hr, body, creds, service, region, time.Now())
+
+	r, err := HTTPClient.Do(hr)
+	if nil != err {
+		return err
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		return err
+	}
+	if http.StatusOK != r.StatusCode {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &e)
+		return fmt.Errorf("%v %v failed: %v %v", target, action,
+			r.Status, strings.TrimSpace(e.Type+" "+e.Message))
+	}
+	return json.Unmarshal(b, res)
+}
+
+// awsSign signs req, whose body is body, with AWS Signature Version 4 for
+// service in region at time t
+func awsSign(req *http.Request, body []byte, creds awsCreds, service,
+	region string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if "" != creds.Token {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+	bodyHash := awsHash(body)
+	/* S3 wants to know it too */
+	if "s3" == service {
+		req.Header.Set("X-Amz-Content-Sha256", bodyHash)
+	}
+
+	/* Canonical headers, sorted by lower-case name */
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(
+			strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var ch strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&ch, "%v:%v\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	/* The request, hashed and signed, with the path sent as it's
+	signed */
+	path := awsEscapePath(req.URL.Path)
+	if "" == path {
+		path = "/"
+	}
+	req.URL.RawPath = path
+	canonical := strings.Join([]string{req.Method, path,
+		req.URL.RawQuery, ch.String(), signed, bodyHash}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"},
+		"/")
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope,
+		awsHash([]byte(canonical))}, "\n")
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = awsHMAC(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 "+
+		"Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.AccessKeyID, scope, signed,
+		hex.EncodeToString(awsHMAC(key, toSign))))
+}
+
+// awsEscapePath returns p with every byte other than / and the unreserved
+// characters A-Z, a-z, 0-9, -, ., _, and ~ percent-encoded, as Signature
+// Version 4 wants, unlike url.URL's EscapedPath
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') ||
+			('0' <= c && c <= '9') || strings.IndexByte("-._~/",
+			c) != -1 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+/* awsHash returns the hex-encoded SHA-256 hash of b */
+func awsHash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+/* awsHMAC returns the HMAC-SHA256 of s with key */
+func awsHMAC(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
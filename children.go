@@ -0,0 +1,98 @@
+package confflags
+
+import (
+	"os"
+	"sync"
+)
+
+/* Child processes which are signalled when a config change is applied */
+type childState struct {
+	children    map[int]*os.Process
+	childSignal os.Signal
+	childLock   sync.Mutex
+}
+
+func (s *childState) init() {
+	s.children = make(map[int]*os.Process)
+	s.childSignal = defaultSignal
+}
+
+// AddChild registers the process with the given PID to be sent a signal
+// (SIGHUP unless changed with SetChildSignal) every time a change to the
+// config is applied.  This is meant for supervisor-style programs whose
+// workers re-read their own config on a signal.
+func AddChild(pid int) error {
+	return std.AddChild(pid)
+}
+
+// AddChild registers the process with the given PID to be sent a signal
+// every time a change to cf's config is applied.  See the package-level
+// AddChild.
+func (cf *ConfFlags) AddChild(pid int) error {
+	p, err := os.FindProcess(pid)
+	if nil != err {
+		return err
+	}
+	cf.childLock.Lock()
+	defer cf.childLock.Unlock()
+	cf.children[pid] = p
+	return nil
+}
+
+// RemoveChild stops sending signals to the process with the given PID.
+// Children which have exited are removed automatically the next time a
+// signal fails to be delivered.
+func RemoveChild(pid int) {
+	std.RemoveChild(pid)
+}
+
+// RemoveChild stops sending signals to the process with the given PID when
+// cf's config changes.
+func (cf *ConfFlags) RemoveChild(pid int) {
+	cf.childLock.Lock()
+	defer cf.childLock.Unlock()
+	delete(cf.children, pid)
+}
+
+// SetChildSignal sets the signal sent to children registered with AddChild
+// when a config change is applied.  The default is SIGHUP, or none under
+// js/wasm.  If sig is nil, children aren't signalled.
+func SetChildSignal(sig os.Signal) {
+	std.SetChildSignal(sig)
+}
+
+// SetChildSignal sets the signal sent to children registered with
+// cf.AddChild when a change to cf's config is applied.  The default is
+// SIGHUP.
+func (cf *ConfFlags) SetChildSignal(sig os.Signal) {
+	cf.childLock.Lock()
+	defer cf.childLock.Unlock()
+	cf.childSignal = sig
+}
+
+// Send the child signal to all registered children.  Errors are returned
+// keyed by PID, or nil if there were none.
+func (s *childState) signalChildren() map[int]error {
+	s.childLock.Lock()
+	defer s.childLock.Unlock()
+	if nil == s.childSignal {
+		return nil
+	}
+	var errs map[int]error
+	for pid, p := range s.children {
+		err := p.Signal(s.childSignal)
+		if nil == err {
+			continue
+		}
+		/* Forget about children which have gone away */
+		if err == os.ErrProcessDone {
+			delete(s.children, pid)
+			continue
+		}
+		if nil == errs {
+			errs = make(map[int]error)
+		}
+		errs[pid] = err
+	}
+	return errs
+}
@@ -0,0 +1,125 @@
+package confflags
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells confflags the time.  It may be replaced with SetClock, e.g.
+// with a ManualClock so tests can control when the config is re-read.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After sends the current time on the returned channel once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+/* realClock is the default Clock */
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+/* The clock in use */
+var (
+	clock     Clock = realClock{}
+	clockLock sync.Mutex
+)
+
+// SetClock sets the Clock used for -configUpdateInterval, circuit breakers,
+// webhook retries, and the like.  A nil Clock restores the real time.
+func SetClock(c Clock) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	if nil == c {
+		c = realClock{}
+	}
+	clock = c
+}
+
+/* now returns the current time according to the clock */
+func now() time.Time {
+	clockLock.Lock()
+	c := clock
+	clockLock.Unlock()
+	return c.Now()
+}
+
+/* after returns a channel which fires when d has elapsed on the clock */
+func after(d time.Duration) <-chan time.Time {
+	clockLock.Lock()
+	c := clock
+	clockLock.Unlock()
+	return c.After(d)
+}
+
+/* sleep waits for d to elapse according to the clock */
+func sleep(d time.Duration) {
+	<-after(d)
+}
+
+// ManualClock is a Clock whose time only changes when Advance is called.
+type ManualClock struct {
+	now     time.Time
+	waiters []manualWaiter
+	lock    sync.Mutex
+}
+
+/* manualWaiter is a channel waiting for a ManualClock to reach a time */
+type manualWaiter struct {
+	when time.Time
+	c    chan time.Time
+}
+
+// NewManualClock returns a ManualClock set to t.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{now: t}
+}
+
+// Now returns the ManualClock's time.
+func (m *ManualClock) Now() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.now
+}
+
+// After returns a channel on which the time is sent once Advance has moved
+// the clock forward by at least d.
+func (m *ManualClock) After(d time.Duration) <-chan time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c := make(chan time.Time, 1)
+	if 0 >= d {
+		c <- m.now
+		return c
+	}
+	m.waiters = append(m.waiters, manualWaiter{m.now.Add(d), c})
+	return c
+}
+
+// Advance moves the clock forward by d, waking up anything waiting for
+// the new time or earlier.
+func (m *ManualClock) Advance(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.now = m.now.Add(d)
+	waiting := m.waiters[:0]
+	for _, w := range m.waiters {
+		if w.when.After(m.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- m.now
+	}
+	m.waiters = waiting
+}
+
+// Waiters returns the number of calls to After which are still waiting,
+// which tests can use to make sure something is waiting before calling
+// Advance.
+func (m *ManualClock) Waiters() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.waiters)
+}
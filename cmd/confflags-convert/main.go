@@ -0,0 +1,161 @@
+// Confflags-convert translates config files between the formats understood
+// by confflags, optionally normalizing key names along the way.
+//
+// Usage:
+//
+//	confflags-convert [-from format] [-to format] [-keys style]
+//		[-schema schema.conf] [-o output] [input]
+//
+// The input is read from stdin if no file is given.  If -schema is given
+// (normally a program's -dumpflags output), keys which differ from a flag
+// name only in case or in the use of -, _, and . are changed to the flag
+// name.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kd5pbo/confflags"
+)
+
+var (
+	from = flag.String("from", "conf", "Input format, one of "+
+		strings.Join(confflags.Formats(), ", "))
+	to = flag.String("to", "conf", "Output format, one of "+
+		strings.Join(confflags.Formats(), ", "))
+	keys = flag.String("keys", "", "Key style, one of lower, dash "+
+		"(a-b), underscore (a_b), or dot (a.b).  Keys are unchanged "+
+		"if unset.")
+	schemaFile = flag.String("schema", "", "File containing a program's "+
+		"-dumpflags output, used to normalize keys to flag names")
+	output = flag.String("o", "", "Output file (default stdout)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [options] [input]\n\n"+
+			"Options:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if 1 < flag.NArg() {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := convert(); nil != err {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func convert() error {
+	/* Work out the formats */
+	in := confflags.LookupFormat(*from)
+	if nil == in {
+		return fmt.Errorf("unknown format %q", *from)
+	}
+	out := confflags.LookupFormat(*to)
+	if nil == out {
+		return fmt.Errorf("unknown format %q", *to)
+	}
+	rename, err := keyStyle(*keys)
+	if nil != err {
+		return err
+	}
+
+	/* Read the input */
+	var r io.Reader = os.Stdin
+	name := "stdin"
+	if 1 == flag.NArg() {
+		name = flag.Arg(0)
+		f, err := os.Open(name)
+		if nil != err {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	args, err := in.Read(r, name)
+	if nil != err {
+		return err
+	}
+
+	/* Normalize the keys */
+	canon, err := readSchema()
+	if nil != err {
+		return err
+	}
+	for i := range args {
+		args[i].Key = rename(args[i].Key)
+		if n, ok := canon[squash(args[i].Key)]; ok {
+			args[i].Key = n
+		}
+	}
+
+	/* Write the output */
+	if "" == *output {
+		return out.Write(os.Stdout, args)
+	}
+	f, err := os.Create(*output)
+	if nil != err {
+		return err
+	}
+	if err := out.Write(f, args); nil != err {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+/* keyStyle returns a function which renames keys in the given style */
+func keyStyle(style string) (func(string) string, error) {
+	sep := func(s string) func(string) string {
+		r := strings.NewReplacer("-", s, "_", s, ".", s)
+		return r.Replace
+	}
+	switch style {
+	case "":
+		return func(k string) string { return k }, nil
+	case "lower":
+		return strings.ToLower, nil
+	case "dash":
+		return sep("-"), nil
+	case "underscore":
+		return sep("_"), nil
+	case "dot":
+		return sep("."), nil
+	}
+	return nil, fmt.Errorf("unknown key style %q", style)
+}
+
+// readSchema returns the flag names in the schema file, keyed by their
+// squashed forms
+func readSchema() (map[string]string, error) {
+	canon := make(map[string]string)
+	if "" == *schemaFile {
+		return canon, nil
+	}
+	f, err := os.Open(*schemaFile)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	schema, err := confflags.ReadSchema(f, *schemaFile)
+	if nil != err {
+		return nil, err
+	}
+	for _, s := range schema {
+		canon[squash(s.Key)] = s.Key
+	}
+	return canon, nil
+}
+
+/* squash lowercases k and removes separators */
+func squash(k string) string {
+	return strings.NewReplacer("-", "", "_", "", ".", "").Replace(
+		strings.ToLower(k))
+}
@@ -0,0 +1,98 @@
+// Confflags-lint checks config files against the flags registered by a
+// program which uses confflags, so config files can be checked before they're
+// deployed.
+//
+// Usage:
+//
+//	confflags-lint -schema schema.conf file.conf...
+//	confflags-lint -binary /path/to/program file.conf...
+//
+// The schema is the output of the program's -dumpflags flag.  If -binary is
+// given, the program is run with -dumpflags to get the schema.  Problems are
+// printed to stderr and the exit status is 1 if any were found.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/kd5pbo/confflags"
+)
+
+var (
+	schemaFile = flag.String("schema", "", "File containing a program's "+
+		"-dumpflags output")
+	binary = flag.String("binary", "", "Program to run with -dumpflags "+
+		"to get the schema")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v {-schema file|-binary "+
+			"program} config...\n\nOptions:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if ("" == *schemaFile) == ("" == *binary) || 0 == flag.NArg() {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	/* Get the flags the program knows about */
+	schema, err := readSchema()
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Unable to get schema: %v\n", err)
+		os.Exit(2)
+	}
+
+	/* Check each config file */
+	bad := false
+	for _, fn := range flag.Args() {
+		f, err := os.Open(fn)
+		if nil != err {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			bad = true
+			continue
+		}
+		args, err := confflags.ReadConfig(f, fn)
+		f.Close()
+		if nil != err {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", fn, err)
+			bad = true
+			continue
+		}
+		for _, err := range confflags.Lint(args, schema) {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			bad = true
+		}
+	}
+	if bad {
+		os.Exit(1)
+	}
+}
+
+// readSchema gets the schema from the file given with -schema or by running
+// the program given with -binary
+func readSchema() ([]confflags.Arg, error) {
+	if "" != *schemaFile {
+		f, err := os.Open(*schemaFile)
+		if nil != err {
+			return nil, err
+		}
+		defer f.Close()
+		return confflags.ReadSchema(f, *schemaFile)
+	}
+	/* Programs often exit non-zero after dumping flags, so only fail if
+	there's no output */
+	out, err := exec.Command(*binary, "-config=", "-dumpflags").Output()
+	if 0 == len(out) {
+		if nil == err {
+			err = fmt.Errorf("no output")
+		}
+		return nil, err
+	}
+	return confflags.ReadSchema(bytes.NewReader(out), *binary)
+}
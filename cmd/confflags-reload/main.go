@@ -0,0 +1,35 @@
+// Command confflags-reload asks programs which use confflags to re-read
+// their config by modifying the file they watch, set with
+// confflags.SetReloadTrigger.  This is meant for Windows, which has no
+// SIGHUP.
+//
+// Usage:
+//
+//	confflags-reload file [file...]
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix(filepath.Base(os.Args[0]) + ": ")
+	if 2 > len(os.Args) {
+		fmt.Fprintf(os.Stderr, "Usage: %v file [file...]\n", os.Args[0])
+		os.Exit(2)
+	}
+	/* Writing the time changes the file even if it's touched twice in
+	quick succession */
+	for _, path := range os.Args[1:] {
+		if err := ioutil.WriteFile(path, []byte(time.Now().Format(
+			time.RFC3339Nano)+"\n"), 0644); nil != err {
+			log.Fatalf("Unable to trigger reload: %v", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package confflags
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/* Character which starts comments at the ends of lines */
+type commentState struct {
+	commentChar rune /* 0 for none */
+	commentLock sync.Mutex
+}
+
+func (s *commentState) init() {
+	s.commentChar = '#'
+}
+
+// SetCommentChar sets the character which starts a comment at the end of a
+// line in the config file, by default #.  For example,
+//
+//	port 8080  # Public HTTP port
+//
+// sets -port to 8080.  The character only starts a comment at the start of
+// the line or after whitespace, and not within a quoted value, so values
+// containing it, like "#fff", must be quoted.  Lines starting with # are
+// always comments.  A c of 0 turns off end-of-line comments.
+func SetCommentChar(c rune) {
+	std.SetCommentChar(c)
+}
+
+// SetCommentChar sets the character which starts a comment at the end of a
+// line in cf's config file.  See the package-level SetCommentChar.
+func (cf *ConfFlags) SetCommentChar(c rune) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.commentLock.Lock()
+	defer cf.commentLock.Unlock()
+	cf.commentChar = c
+	cf.lastDeps = nil
+}
+
+/* getCommentChar returns the character set with SetCommentChar */
+func (s *commentState) getCommentChar() rune {
+	s.commentLock.Lock()
+	defer s.commentLock.Unlock()
+	return s.commentChar
+}
+
+// stripComment returns line without the comment at its end, if it has one,
+// and the whitespace before it.  The comment starts with c at the start of
+// the line or after whitespace, outside of quotes, which only count after
+// whitespace.  A c of 0 means there are no comments.
+func stripComment(line string, c rune) string {
+	if 0 == c {
+		return line
+	}
+	var (
+		quote   rune /* Quote we're in, if any */
+		escaped bool /* Last character was a backslash in "s */
+		space   = true
+	)
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case '"' == quote && '\\' == r:
+			escaped = true
+		case 0 != quote:
+			if r == quote {
+				quote = 0
+			}
+		case r == c && space:
+			return strings.TrimRightFunc(line[:i], unicode.IsSpace)
+		case ('"' == r || '\'' == r) && space:
+			quote = r
+		}
+		space = unicode.IsSpace(r)
+	}
+	return line
+}
+
+// hasComment reports whether some of v would be taken as a comment by
+// stripComment
+func hasComment(v string, c rune) bool {
+	return stripComment(v, c) != v
+}
@@ -4,39 +4,189 @@ package confflags
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
-/* Library-specific command line flags */
-var (
-	config               = flag.String("config", "", "config file")
-	configUpdateInterval = flag.Duration("configUpdateInterval", 0,
-		"Update interval for re-reading config file set via -config "+
-			"flag. Zero disables config file re-reading.  "+
-			"Interval may end in s, m, or h to indicate seconds, "+
-			"minutes, or hours respectively.")
-	dumpflags = flag.Bool("dumpflags", false, "Prints all flags and "+
-		"config options to stdout in a format useable for -config")
-)
+// ConfFlags reads the flags in a flag.FlagSet from a config file as well as
+// from the command line.  Each ConfFlags has its own config file, callbacks,
+// and other settings, so a library can manage its own config independently
+// of the program using it.  The package-level functions use a ConfFlags for
+// flag.CommandLine.
+type ConfFlags struct {
+	fs *flag.FlagSet
 
-/* State variables */
-var (
-	flagChangeCallbacks = make(map[string][]FlagChangeCallback)
-	importStack         []string
+	/* Library-specific command line flags */
+	config               *configValue
+	configUpdateInterval *time.Duration
+	dumpflags            *dumpValue
+	dumpflagsOut         *string
+	dumpflagsNonDefault  *bool
+	dumpflagsSources     *bool
+	configUpdateSchedule *scheduleValue
+	envfile              *string
+	configFormat         *string
+	configWatchInterval  *time.Duration
+
+	/* State variables */
+	flagChangeCallbacks map[string][]*callbackReg
+	anyChangeCallbacks  []*callbackReg /* From OnAnyFlagChange */
+	callbackLock        sync.Mutex     /* Guards the callbacks */
 	parsed              bool
 	updateLock          sync.Mutex /* Concurrent updates would be bad */
+	/* Called with the result of every update, with updateLock held */
+	updateHooks []func(UpdateResult)
 	/* Wake up the interval watcher */
-	cond = sync.NewCond(&sync.Mutex{})
-)
+	cond *sync.Cond
+
+	annotationState
+	childState
+	commentState
+	defaultState
+	deprecationState
+	depsState
+	dumpState
+	envState
+	generationState
+	hookState
+	immutableState
+	namespaceState
+	originState
+	renameState
+	searchState
+	resolveState
+	secretsState
+	sectionState
+	shutdownState
+	signalState
+	sourceState
+	triggerState
+	unknownState
+	validateState
+	warningState
+}
+
+// New returns a ConfFlags with its own flag.FlagSet, made with
+// flag.NewFlagSet(name, errorHandling).  Flags are defined with the FlagSet
+// returned by FlagSet.  There's no command line for Parse to parse, so the
+// config file is set by setting -config in the FlagSet before Parse is
+// called, or given in the arguments passed to ParseArgs.
+func New(name string, errorHandling flag.ErrorHandling) *ConfFlags {
+	return newConfFlags(flag.NewFlagSet(name, errorHandling))
+}
+
+// NewFlagSet returns a ConfFlags which reads the flags in fs, adding
+// confflags' own flags (-config, etc.) to fs.  It should only be called once
+// for any given FlagSet.  For flag.CommandLine, the ConfFlags used by the
+// package-level functions is returned.
+func NewFlagSet(fs *flag.FlagSet) *ConfFlags {
+	if flag.CommandLine == fs {
+		return std
+	}
+	return newConfFlags(fs)
+}
+
+// ParseFlagSet is like ParseWithResult, but for the flags in fs and with the
+// command line arguments in args.  It returns the ConfFlags made for fs with
+// NewFlagSet, which may be used to register callbacks, re-read the config,
+// and so on.  Callbacks registered afterwards may be given the Immediately
+// option to be called with the values from the first read of the config, or
+// NewFlagSet and ParseArgs may be used instead.
+func ParseFlagSet(fs *flag.FlagSet, args []string, c chan UpdateResult) (
+	*ConfFlags, error) {
+	cf := NewFlagSet(fs)
+	_, err := cf.parse(args, c)
+	return cf, err
+}
+
+/* newConfFlags returns a ConfFlags for fs, adding our own flags to it */
+func newConfFlags(fs *flag.FlagSet) *ConfFlags {
+	cf := &ConfFlags{
+		fs:     fs,
+		config: &configValue{},
+		configUpdateInterval: fs.Duration("configUpdateInterval", 0,
+			"Update interval for re-reading config file set via "+
+				"-config flag. Zero disables config file "+
+				"re-reading.  Interval may end in s, m, or h "+
+				"to indicate seconds, minutes, or hours "+
+				"respectively."),
+		dumpflags:            &dumpValue{},
+		configUpdateSchedule: &scheduleValue{},
+		envfile: fs.String("envfile", "", "File of KEY=value "+
+			"lines which set flags as environment variables "+
+			"would.  Defaults to .env if flags are set from the "+
+			"environment."),
+		configFormat: fs.String("configFormat", "", "Format of the "+
+			"-config file, e.g. conf, toml, yaml, json, or hcl.  "+
+			"Defaults to the format named by the file's "+
+			"extension, or conf."),
+		configWatchInterval: fs.Duration("configWatchInterval", 0,
+			configWatchIntervalUsage),
+		dumpflagsOut: fs.String("dumpflagsOut", "", "File to which to "+
+			"write the flags, as with -dumpflags, instead of "+
+			"stdout.  The format is chosen by the file's "+
+			"extension unless given with -dumpflags=format."),
+		dumpflagsNonDefault: fs.Bool("dumpflagsNonDefault", false,
+			"Dumps only the flags which differ from their "+
+				"defaults, as with -dumpflags, noting the "+
+				"defaults in comments."),
+		dumpflagsSources: fs.Bool("dumpflagsSources", false, "Notes "+
+			"where each flag got its value, e.g. the command line "+
+			"or a line of a config file, in comments when "+
+			"dumping flags, as with -dumpflags."),
+		flagChangeCallbacks: make(map[string][]*callbackReg),
+		cond:                sync.NewCond(&sync.Mutex{}),
+	}
+	fs.Var(&lockedConfigValue{cf.config, &cf.searchLock}, "config",
+		"config file; may be repeated, with later files overriding "+
+			"earlier ones")
+	fs.Var(cf.configUpdateSchedule, "configUpdateSchedule",
+		configUpdateScheduleUsage)
+	fs.Var(cf.dumpflags, "dumpflags", "Prints all flags and config "+
+		"options to stdout in a format useable for -config.  A "+
+		"format, e.g. json, yaml, toml, or ini, may be given with "+
+		"-dumpflags=format.")
+	cf.annotationState.init()
+	cf.childState.init()
+	cf.commentState.init()
+	cf.defaultState.init()
+	cf.deprecationState.init()
+	cf.dumpState.init()
+	cf.generationState.init()
+	cf.originState.init()
+	cf.sectionState.init()
+	cf.shutdownState.init()
+	cf.signalState.init()
+	cf.triggerState.init()
+	cf.sourceState.init()
+	/* Our own flags get their own group */
+	cf.SetGroup("Config", "config", "configUpdateInterval",
+		"configUpdateSchedule", "configWatchInterval", "dumpflags",
+		"dumpflagsOut", "dumpflagsNonDefault", "dumpflagsSources",
+		"envfile", "configFormat")
+	return cf
+}
+
+/* std is the ConfFlags for flag.CommandLine, used by the package functions */
+var std = func() *ConfFlags {
+	cf := newConfFlags(flag.CommandLine)
+	cf.generation = &Generation
+	return cf
+}()
+
+// FlagSet returns the flag.FlagSet whose flags cf reads.
+func (cf *ConfFlags) FlagSet() *flag.FlagSet {
+	return cf.fs
+}
 
 /* Regular expression to split lines */
 var splitRE = regexp.MustCompile(`\s+`)
@@ -45,123 +195,360 @@ var (
 	// flags' generation number.
 	// It is modified on each flags' modification
 	// via either -configUpdateInterval or SIGHUP.
+	// It is only used for flag.CommandLine; see ConfFlags.Generation.
 	Generation = 0
 	// DumpedFlags is the error returned when Parse() is called and
-	// -dumpflags is given on the command line.
+	// -dumpflags is given on the command line, unless SetDumpHandler has
+	// been used to change what happens, or -dumpflagsOut is given.
 	DumpedFlags = errors.New("Dumped")
+	// FatalFunc is called by MustParse if Parse returns an error.  By
+	// default, it prints the error to stderr and exits with status 1.
+	FatalFunc = func(err error) {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", os.Args[0], err)
+		os.Exit(1)
+	}
+	// ExitFunc is called by MustParse and ExitAfterDump with a status
+	// of 0 after the flags have been dumped.
+	ExitFunc = os.Exit
 )
 
 // Use instead of flag.Parse().  If c is not nil, results from updating the
 // config file either via SIGHUP or -configUpdateInterval will be sent out on
 // it.
 func Parse(c chan UpdateResult) error {
+	return std.Parse(c)
+}
+
+// Parse parses the command line, if cf is for flag.CommandLine, and reads
+// the config file.  If c is not nil, results from updating the config file
+// either via SIGHUP or -configUpdateInterval will be sent out on it.
+func (cf *ConfFlags) Parse(c chan UpdateResult) error {
+	_, err := cf.ParseWithResult(c)
+	return err
+}
+
+// ParseArgs is like Parse, but parses the flags in args instead of those in
+// os.Args, e.g. for arguments from a wrapper process or a test.
+func ParseArgs(args []string, c chan UpdateResult) error {
+	return std.ParseArgs(args, c)
+}
+
+// ParseArgs is like Parse, but parses the flags in args instead of those on
+// the command line.
+func (cf *ConfFlags) ParseArgs(args []string, c chan UpdateResult) error {
+	_, err := cf.parse(args, c)
+	return err
+}
+
+// MustParse is like Parse, but calls FatalFunc if Parse returns an error and
+// ExitFunc(0) if Parse returns DumpedFlags.
+func MustParse(c chan UpdateResult) {
+	std.MustParse(c)
+}
+
+// MustParse is like Parse, but calls FatalFunc if Parse returns an error and
+// ExitFunc(0) if Parse returns DumpedFlags.
+func (cf *ConfFlags) MustParse(c chan UpdateResult) {
+	switch err := cf.Parse(c); err {
+	case nil:
+	case DumpedFlags:
+		ExitFunc(0)
+	default:
+		FatalFunc(err)
+	}
+}
+
+// ParseWithResult is like Parse, but also returns the flags which were set
+// from the config file when it was first read, in the same form as the
+// UpdateResults sent on c for later reads.  ChangedFlags holds the values
+// from the config file and OldValues holds the defaults they replaced.  Flags
+// not in ChangedFlags were either set on the command line or left at their
+// defaults.
+func ParseWithResult(c chan UpdateResult) (UpdateResult, error) {
+	return std.ParseWithResult(c)
+}
+
+// ParseWithResult is like Parse, but also returns the flags which were set
+// from the config file when it was first read.  See the package-level
+// ParseWithResult.
+func (cf *ConfFlags) ParseWithResult(c chan UpdateResult) (UpdateResult,
+	error) {
+	/* Only flag.CommandLine has a command line */
+	var args []string
+	if flag.CommandLine == cf.fs {
+		args = os.Args[1:]
+	}
+	return cf.parse(args, c)
+}
+
+/* parse does the work for ParseWithResult, using args as the command line */
+func (cf *ConfFlags) parse(args []string, c chan UpdateResult) (UpdateResult,
+	error) {
 	/* Don't double-parse */
-	if parsed {
-		return fmt.Errorf("flags already parsed")
+	if cf.parsed {
+		return UpdateResult{}, fmt.Errorf("flags already parsed")
 	}
 
-	/* Parse the flags on the command line */
-	flag.Parse()
-	parsed = true
+	/* Work out defaults which can't be known in advance */
+	if err := cf.applyDefaultFuncs(); nil != err {
+		return UpdateResult{}, err
+	}
+
+	/* Parse the flags on the command line, including any in @files */
+	args, err := expandArgsFiles(args, nil)
+	if nil != err {
+		return UpdateResult{}, err
+	}
+	if err := cf.fs.Parse(args); nil != err {
+		return UpdateResult{}, err
+	}
+	if err := cf.setDeprecatedFlags(); nil != err {
+		return UpdateResult{}, err
+	}
+	cf.parsed = true
 
-	/* Get the key/value pairs from the config file */
-	if _, err := parseConfigFlags(); nil != err {
-		return err
+	/* Get the key/value pairs from the config file, or from the parent
+	process if we were started by Reexec */
+	var oldFlagValues map[string]string
+	sa, ok, err := cf.reexecStateArgs()
+	if nil != err {
+		return UpdateResult{}, err
+	} else if ok {
+		oldFlagValues, err = cf.applyArgs(sa, true)
+	} else {
+		oldFlagValues, err = cf.parseConfigFlags()
+	}
+	if nil != err {
+		return UpdateResult{}, err
+	}
+	initial := UpdateResult{
+		ChangedFlags: cf.redactValues(cf.currentValues(oldFlagValues)),
+		OldValues:    cf.redactValues(oldFlagValues),
 	}
 
 	/* Print the current state, if requested */
-	if *dumpflags {
-		dumpFlags()
-		return DumpedFlags
+	if format := cf.dumpFormat(); "" != format {
+		var b bytes.Buffer
+		if err := cf.dumpFlags(&b, format); nil != err {
+			return initial, err
+		}
+		if path := *cf.dumpflagsOut; "" != path {
+			if err := writeDumpFile(path, b.Bytes()); nil != err {
+				return initial, fmt.Errorf("unable to write "+
+					"flags to %v: %v", path, err)
+			}
+			return initial, DumpedFlags
+		}
+		return initial, cf.handleDump(b.Bytes())
 	}
 
 	/* Now that we have all the flags, make sure there's no extra
 	callbacks registered */
-	for flagName, _ := range flagChangeCallbacks {
-		if err := verifyFlagChangeFlagName(flagName); nil != err {
-			return err
+	cf.callbackLock.Lock()
+	for flagName, _ := range cf.flagChangeCallbacks {
+		if err := cf.verifyFlagChangeFlagName(flagName); nil != err {
+			cf.callbackLock.Unlock()
+			return UpdateResult{}, err
 		}
 	}
+	cf.callbackLock.Unlock()
 	/* First generation of flags */
-	Generation++
-	issueAllFlagChangeCallbacks()
+	cf.nextGeneration()
+	cf.issueAllFlagChangeCallbacks(oldFlagValues)
 
 	/* Recheck in intervals, if needed */
+	cf.results = c
+	cf.loopWG.Add(7)
 	go func() {
+		defer cf.loopWG.Done()
 		for {
 			/* Sleep and update if there's an update interval */
-			for *configUpdateInterval != 0 {
-				time.Sleep(*configUpdateInterval)
-				changes := updateConfig()
-				/* Send out the changes, if needed */
-				if nil != c {
-					go func() { c <- changes }()
+			for d := *cf.configUpdateInterval; 0 != d; d =
+				*cf.configUpdateInterval {
+				if !cf.sleepUnlessStopped(d) {
+					return
 				}
+				cf.sendResult(c, cf.updateConfig())
 			}
 			/* Wait to be woke up */
-			cond.L.Lock()
-			cond.Wait()
-			cond.L.Unlock()
+			if !cf.waitForChange() {
+				return
+			}
 		}
 	}()
 
-	/* Register to catch SIGHUP */
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGHUP)
-	/* Goroutine to do the catching */
+	/* Recheck when the config files change, if needed */
+	go func() {
+		defer cf.loopWG.Done()
+		stamps := cf.configStamps()
+		for {
+			for d := *cf.configWatchInterval; 0 != d; d =
+				*cf.configWatchInterval {
+				if !cf.sleepUnlessStopped(d) {
+					return
+				}
+				if cf.configChanged(stamps) {
+					cf.sendResult(c, cf.updateConfig())
+				}
+			}
+			/* Wait to be woke up */
+			if !cf.waitForChange() {
+				return
+			}
+		}
+	}()
+
+	/* Recheck on a schedule, if needed */
 	go func() {
-		/* Catch a SIGHUP */
-		for _ = range ch {
-			/* Update the state */
-			changes := updateConfig()
-			/* Send out the changes, if needed */
-			if nil != c {
-				go func() { c <- changes }()
+		defer cf.loopWG.Done()
+		for {
+			/* Sleep until the next time on the schedule */
+			for s := cf.configUpdateSchedule.get(); nil != s; s =
+				cf.configUpdateSchedule.get() {
+				t := now()
+				if !cf.sleepUnlessStopped(s.next(t).Sub(t)) {
+					return
+				}
+				cf.sendResult(c, cf.updateConfig())
+			}
+			/* Wait to be woke up */
+			if !cf.waitForChange() {
+				return
 			}
 		}
 	}()
-	return nil
+
+	/* Recheck when resolved values expire */
+	go func() {
+		defer cf.loopWG.Done()
+		cf.refreshWhenExpired(c)
+	}()
+
+	/* Recheck when a Source says it's changed */
+	go func() {
+		defer cf.loopWG.Done()
+		cf.watchSources(c)
+	}()
+
+	/* Recheck when the trigger file changes, if there is one */
+	go func() {
+		defer cf.loopWG.Done()
+		cf.watchTrigger()
+	}()
+
+	/* Register to catch SIGHUP, or whatever's been set */
+	ch := cf.notifySignals()
+	/* Goroutine to do the catching */
+	go func() {
+		defer cf.loopWG.Done()
+		defer cf.stopSignals()
+		cf.reloadOnSignals(c, ch)
+	}()
+	return initial, nil
 }
 
 // Every time the config file is re-read, an UpdateResult struct is sent out
 // via the channel passed to Parse, if the channel is non-nil.
 
-// UpdateResult contains the results of re-reading the config file.  Either
-// ChangedFlags or Err will be set, but not both.
+// UpdateResult contains the results of re-reading the config file.  At most
+// one of ChangedFlags, Err, and Vetoed will be set.  The values of secret
+// flags (see MarkSensitive) are given as *****.
 type UpdateResult struct {
 	ChangedFlags map[string]string /* Flags that changed when the file
 	was read */
 	Err       error             /* An error occurred reading the file */
 	OldValues map[string]string /* The previous values for the changed flags */
+	/* Errors sending the change signal to children registered with
+	AddChild, keyed by PID */
+	ChildErrs map[int]error
+	/* Set instead of Err if a BeforeReload hook cancelled the update */
+	Vetoed error
+	/* The changed flags, sorted, which were annotated with RestartRequired
+	and whose callbacks weren't called, as the program needs a restart */
+	RestartRequired []string
+	/* The flags, sorted, which were annotated with Immutable and whose
+	changes were ignored */
+	Ignored []string
+}
+
+/* sendResult sends res on c, if c isn't nil */
+func (cf *ConfFlags) sendResult(c chan UpdateResult, res UpdateResult) {
+	if nil == c {
+		return
+	}
+	cf.sendWG.Add(1)
+	go func() {
+		defer cf.sendWG.Done()
+		select {
+		case c <- res:
+		case <-cf.dropCh:
+		}
+	}()
 }
 
 /* Re-read the config file and update the state of the flags */
-func updateConfig() UpdateResult {
-	updateLock.Lock()
-	defer updateLock.Unlock()
+func (cf *ConfFlags) updateConfig() UpdateResult {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
 	/* Parse the new config file, get the old values (or an error) */
-	oldFlagValues, err := parseConfigFlags()
+	return cf.finishUpdate(cf.parseConfigFlags())
+}
+
+// finishUpdate tells everybody who needs to know about the changes to the
+// flags whose previous values are in oldFlagValues, or returns err if it's
+// not nil.  updateLock must be held.
+func (cf *ConfFlags) finishUpdate(oldFlagValues map[string]string,
+	err error) UpdateResult {
+	res := cf.notifyUpdate(oldFlagValues, err)
+	/* Let the hooks know if anything happened */
+	if nil != res.Err || 0 != len(res.ChangedFlags) {
+		for _, h := range cf.updateHooks {
+			h(res)
+		}
+	}
+	return res
+}
+
+/* notifyUpdate does most of the work for finishUpdate */
+func (cf *ConfFlags) notifyUpdate(oldFlagValues map[string]string,
+	err error) UpdateResult {
+	if v, ok := err.(vetoError); ok {
+		return UpdateResult{Vetoed: v.err}
+	}
 	if nil != err {
 		return UpdateResult{Err: err}
 	}
 	/* Return if there's no change */
 	if 0 == len(oldFlagValues) {
-		return UpdateResult{}
+		return UpdateResult{Ignored: cf.ignored}
 	}
 
-	modifiedFlags := make(map[string]string)
-	for k, _ := range oldFlagValues {
-		modifiedFlags[k] = flag.Lookup(k).Value.String()
-	}
-	Generation++
-	issueFlagChangeCallbacks(oldFlagValues)
+	modifiedFlags := cf.currentValues(oldFlagValues)
+	cf.nextGeneration()
+	restart, others := cf.splitRestartRequired(oldFlagValues)
+	cf.issueFlagChangeCallbacks(others)
+	/* Let child processes know things have changed */
+	childErrs := cf.signalChildren()
 	/* Wake up a sleeping interval watcher */
-	if nil != configUpdateInterval {
-		cond.L.Lock()
-		defer cond.L.Unlock()
-		cond.Broadcast()
+	cf.cond.L.Lock()
+	defer cf.cond.L.Unlock()
+	cf.cond.Broadcast()
+	return UpdateResult{
+		ChangedFlags:    cf.redactValues(modifiedFlags),
+		OldValues:       cf.redactValues(oldFlagValues),
+		ChildErrs:       childErrs,
+		RestartRequired: restart,
+		Ignored:         cf.ignored,
 	}
-	return UpdateResult{ChangedFlags: modifiedFlags}
+}
+
+/* currentValues returns the current values of the flags named in names */
+func (cf *ConfFlags) currentValues(names map[string]string) map[string]string {
+	vals := make(map[string]string)
+	for k := range names {
+		vals[k] = cf.fs.Lookup(k).Value.String()
+	}
+	return vals
 }
 
 // Callback, which is called when the given flag is changed.
@@ -170,26 +557,237 @@ func updateConfig() UpdateResult {
 type FlagChangeCallback func()
 
 // Registers a callback which is called asynchronously (as go callback())
-// after the given flag value is changed.  Flag value can be changed on config
-// re-read after catching SIGHUP signal or if periodic config re-read is
-// enabled with -configUpdateInterval flag.
+// after the given flag value is changed, or synchronously if the
+// Synchronously option is given.  Flag value can be changed on config
+// re-read after catching SIGHUP signal (see SetReloadSignals) or if
+// periodic config re-read is enabled with -configUpdateInterval flag.
 //
 // Note that flags set via the command line cannot be overriden via config
 // file modifications.
-func OnFlagChange(flagName string, callback FlagChangeCallback) error {
-	if parsed {
-		if err := verifyFlagChangeFlagName(flagName); nil != err {
-			return err
+//
+// Callbacks registered before Parse is called are called once by Parse.
+// Callbacks registered afterwards are only called on changes unless the
+// Immediately option is given.
+//
+// The returned Registration may be used to remove the callback.
+func OnFlagChange(flagName string, callback FlagChangeCallback,
+	opts ...CallbackOption) (*Registration, error) {
+	return std.OnFlagChange(flagName, callback, opts...)
+}
+
+// OnFlagChange registers a callback which is called asynchronously after
+// the given flag in cf's FlagSet is changed.  See the package-level
+// OnFlagChange.
+func (cf *ConfFlags) OnFlagChange(flagName string,
+	callback FlagChangeCallback, opts ...CallbackOption) (*Registration,
+	error) {
+	return cf.onFlagChange(flagName, func(string, string, string) {
+		callback()
+	}, opts)
+}
+
+// OnFlagChangeOnce is like OnFlagChange, but callback is only called the
+// next time the flag changes, after which it's unregistered.  It isn't
+// called by Parse, and the Immediately option is ignored.
+func OnFlagChangeOnce(flagName string, callback FlagChangeCallback,
+	opts ...CallbackOption) (*Registration, error) {
+	return std.OnFlagChangeOnce(flagName, callback, opts...)
+}
+
+// OnFlagChangeOnce is like OnFlagChange, but callback is only called the
+// next time the flag changes.  See the package-level OnFlagChangeOnce.
+func (cf *ConfFlags) OnFlagChangeOnce(flagName string,
+	callback FlagChangeCallback, opts ...CallbackOption) (*Registration,
+	error) {
+	return cf.onFlagChange(flagName, func(string, string, string) {
+		callback()
+	}, append(opts, func(o *callbackOpts) {
+		o.once = true
+		o.immediate = false
+	}))
+}
+
+// FlagValueCallback is called with the name of a flag which has changed and
+// its old and new values.  It may be registered with OnFlagChange2.
+type FlagValueCallback func(name, oldValue, newValue string)
+
+// OnFlagChange2 is like OnFlagChange, but callback is given the flag's name
+// and its old and new values, as they were when the flag changed, so it
+// needn't look the flag up and can't see a later change.  When called by
+// Parse or because of the Immediately option, the old value is the flag's
+// default.
+func OnFlagChange2(flagName string, callback FlagValueCallback,
+	opts ...CallbackOption) (*Registration, error) {
+	return std.OnFlagChange2(flagName, callback, opts...)
+}
+
+// OnFlagChange2 is like OnFlagChange, but callback is given the flag's name
+// and old and new values.  See the package-level OnFlagChange2.
+func (cf *ConfFlags) OnFlagChange2(flagName string,
+	callback FlagValueCallback, opts ...CallbackOption) (*Registration,
+	error) {
+	return cf.onFlagChange(flagName, callback, opts)
+}
+
+// OnAnyFlagChange registers a callback which is called asynchronously after
+// every update which changes any flags, with the changes, sorted by flag
+// name, rather than once for each flag.  Like OnFlagChange's callbacks,
+// those registered before Parse is called are called once by Parse, with
+// the flags set from the config, and those registered afterwards are only
+// called on changes unless the Immediately option is given, in which case
+// they're called with no changes.  Threshold is ignored.  The returned
+// Registration may be used to remove the callback.
+func OnAnyFlagChange(callback func(changes []Change),
+	opts ...CallbackOption) *Registration {
+	return std.OnAnyFlagChange(callback, opts...)
+}
+
+// OnAnyFlagChange registers a callback which is called asynchronously after
+// every update which changes any of cf's flags.  See the package-level
+// OnAnyFlagChange.
+func (cf *ConfFlags) OnAnyFlagChange(callback func(changes []Change),
+	opts ...CallbackOption) *Registration {
+	o := callbackOpts{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	reg := &callbackReg{any: callback, opts: o}
+	cf.callbackLock.Lock()
+	cf.anyChangeCallbacks = append(cf.anyChangeCallbacks, reg)
+	cf.callbackLock.Unlock()
+	if cf.parsed && o.immediate {
+		callback([]Change{})
+	}
+	return &Registration{cf: cf, reg: reg}
+}
+
+/* onFlagChange does the work for OnFlagChange and OnFlagChange2 */
+func (cf *ConfFlags) onFlagChange(flagName string,
+	callback FlagValueCallback, opts []CallbackOption) (*Registration,
+	error) {
+	o := callbackOpts{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cf.parsed {
+		if err := cf.verifyFlagChangeFlagName(flagName); nil != err {
+			return nil, err
 		}
 	}
 	/* Add the call back to the appropriate list */
-	flagChangeCallbacks[flagName] =
-		append(flagChangeCallbacks[flagName], callback)
-	return nil
+	reg := &callbackReg{f: callback, opts: o}
+	cf.callbackLock.Lock()
+	cf.flagChangeCallbacks[flagName] =
+		append(cf.flagChangeCallbacks[flagName], reg)
+	if cf.parsed {
+		reg.noteValue(cf.fs.Lookup(flagName))
+	}
+	cf.callbackLock.Unlock()
+	/* Parse has already called the other callbacks */
+	if cf.parsed && o.immediate {
+		f := cf.fs.Lookup(flagName)
+		callback(flagName, f.DefValue, f.Value.String())
+	}
+	return &Registration{cf: cf, name: flagName, reg: reg}, nil
+}
+
+// CallbackOption changes how a callback registered with OnFlagChange is
+// called.
+type CallbackOption func(*callbackOpts)
+
+/* Options set by CallbackOptions */
+type callbackOpts struct {
+	immediate bool /* Call once on registration after Parse */
+	sync      bool /* Call during the update, not in a goroutine */
+	once      bool /* Unregister after the first change */
+	/* Order in which to call, see Priority */
+	priority    int
+	hasPriority bool
+	/* Minimum change before calling, see Threshold */
+	threshold, thresholdPct float64
+	hasThreshold            bool
+}
+
+/* callbackCall is a call to be made to a registered callback */
+type callbackCall struct {
+	reg *callbackReg
+	f   func()
 }
 
-func verifyFlagChangeFlagName(flagName string) error {
-	if flag.Lookup(flagName) == nil {
+/* callbackReg is a callback registered with OnFlagChange */
+type callbackReg struct {
+	f    FlagValueCallback
+	any  func([]Change) /* Instead of f, for OnAnyFlagChange */
+	opts callbackOpts
+	last float64 /* Value of a numeric flag when last called */
+}
+
+// Immediately causes a callback registered after Parse has been called to be
+// called once, synchronously, before OnFlagChange returns, the same as Parse
+// does for callbacks registered before it was called.  This allows the same
+// code to handle both initial setup and changes.
+func Immediately() CallbackOption {
+	return func(o *callbackOpts) { o.immediate = true }
+}
+
+// Synchronously causes a callback to be called during the update which
+// changed the flag, rather than in its own goroutine, so it's finished
+// before the next callback is called and before the UpdateResult is sent
+// out.  Such callbacks hold up updates, so they should be quick and mustn't
+// cause another update, e.g. by calling Reload or ApplyMap.
+func Synchronously() CallbackOption {
+	return func(o *callbackOpts) { o.sync = true }
+}
+
+// Priority causes callbacks to be called in order of priority, highest
+// first, when several are called because of the same update.  Callbacks
+// which are called Synchronously are called in order during the update;
+// other callbacks with a Priority are then called in order, one at a time,
+// each finishing before the next starts, in a single goroutine.  Callbacks
+// without a Priority are each called in their own goroutine, as usual.  This
+// allows, e.g., a log file to be reopened before the log level is changed.
+func Priority(p int) CallbackOption {
+	return func(o *callbackOpts) {
+		o.priority = p
+		o.hasPriority = true
+	}
+}
+
+// runCallbacks makes calls in order of priority, synchronously or in
+// goroutines as described for Priority
+func (cf *ConfFlags) runCallbacks(calls []callbackCall) {
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].reg.opts.priority > calls[j].reg.opts.priority
+	})
+	var ordered []func()
+	for _, c := range calls {
+		switch {
+		case c.reg.opts.sync:
+			c.f()
+		case c.reg.opts.hasPriority:
+			ordered = append(ordered, c.f)
+		default:
+			cf.callbackWG.Add(1)
+			go func(f func()) {
+				defer cf.callbackWG.Done()
+				f()
+			}(c.f)
+		}
+	}
+	if 0 == len(ordered) {
+		return
+	}
+	cf.callbackWG.Add(1)
+	go func() {
+		defer cf.callbackWG.Done()
+		for _, f := range ordered {
+			f()
+		}
+	}()
+}
+
+func (cf *ConfFlags) verifyFlagChangeFlagName(flagName string) error {
+	if cf.fs.Lookup(flagName) == nil {
 		return fmt.Errorf("cannot register callback for "+
 			"non-existant flag %v", flagName)
 		//		log.Fatalf("iniflags: cannot register FlagChangeCallback for non-existing flag [%s]\n", flagName)
@@ -198,160 +796,414 @@ func verifyFlagChangeFlagName(flagName string) error {
 }
 
 /* Call the callbacks for the flags that changed */
-func issueFlagChangeCallbacks(oldFlagValues map[string]string) {
+func (cf *ConfFlags) issueFlagChangeCallbacks(
+	oldFlagValues map[string]string) {
+	/* Work out which callbacks to call, then call them without holding
+	the lock, so they can register and unregister callbacks */
+	var calls []callbackCall
+	cf.callbackLock.Lock()
 	/* Iterate through changed flags */
 	for flagName := range oldFlagValues {
-		/* Check if we have a list of callbacks */
-		if fs, ok := flagChangeCallbacks[flagName]; ok {
-			/* Call each callback */
-			for _, f := range fs {
-				go f()
+		f := cf.fs.Lookup(flagName)
+		name, old := flagName, oldFlagValues[flagName]
+		v := f.Value.String()
+		for _, reg := range cf.flagChangeCallbacks[flagName] {
+			if !reg.shouldCall(f) {
+				continue
+			}
+			cb := reg.f
+			calls = append(calls, callbackCall{reg,
+				func() { cb(name, old, v) }})
+			if reg.opts.once {
+				cf.unregister(flagName, reg)
 			}
 		}
 	}
+	/* Tell the callbacks interested in all the flags */
+	if 0 != len(oldFlagValues) {
+		changes := cf.changes(oldFlagValues)
+		for _, reg := range cf.anyChangeCallbacks {
+			cb := reg.any
+			calls = append(calls, callbackCall{reg,
+				func() { cb(changes) }})
+		}
+	}
+	cf.callbackLock.Unlock()
+	cf.runCallbacks(calls)
 }
 
-/* Call ALL the callbacks */
-func issueAllFlagChangeCallbacks() {
-	for _, fs := range flagChangeCallbacks {
-		for _, f := range fs {
-			f()
+// changes returns the changes to the flags whose previous values are in
+// oldFlagValues, sorted by flag name, with secret values redacted
+func (cf *ConfFlags) changes(oldFlagValues map[string]string) []Change {
+	changes := make([]Change, 0, len(oldFlagValues))
+	for name, old := range oldFlagValues {
+		changes = append(changes, Change{
+			Name: name,
+			Old:  cf.redactValue(name, old),
+			New: cf.redactValue(name,
+				cf.fs.Lookup(name).Value.String()),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Call ALL the callbacks, with the flags whose previous values are in
+// oldFlagValues for those registered with OnAnyFlagChange
+func (cf *ConfFlags) issueAllFlagChangeCallbacks(
+	oldFlagValues map[string]string) {
+	var calls []callbackCall
+	cf.callbackLock.Lock()
+	for flagName, regs := range cf.flagChangeCallbacks {
+		f := cf.fs.Lookup(flagName)
+		name, def, v := flagName, f.DefValue, f.Value.String()
+		for _, reg := range regs {
+			reg.noteValue(f)
+			/* Only for changes */
+			if reg.opts.once {
+				continue
+			}
+			cb := reg.f
+			calls = append(calls, callbackCall{reg,
+				func() { cb(name, def, v) }})
 		}
 	}
+	changes := cf.changes(oldFlagValues)
+	for _, reg := range cf.anyChangeCallbacks {
+		cb := reg.any
+		calls = append(calls, callbackCall{reg, func() { cb(changes) }})
+	}
+	cf.callbackLock.Unlock()
+	/* Parse calls them all itself, in order */
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].reg.opts.priority > calls[j].reg.opts.priority
+	})
+	for _, c := range calls {
+		c.f()
+	}
 }
 
 /* Update the variables returned by flag.* with values from the config file
 if they weren't specified on the command line */
-func parseConfigFlags() (oldFlagValues map[string]string, err error) {
-	/* Path to the configuration file */
-	configPath := *config
+func (cf *ConfFlags) parseConfigFlags() (oldFlagValues map[string]string,
+	err error) {
+	/* Paths to the configuration files */
+	configPaths := cf.configPaths()
 	/* Short-circuit the default */
-	if configPath == "" {
+	if 0 == len(configPaths) && !cf.usingEnv() && "" == *cf.envfile &&
+		"" == cf.getSecretsDir() &&
+		"" == os.Getenv("CREDENTIALS_DIRECTORY") {
 		return map[string]string{}, nil
 	}
-	/* Get the keys and values from the config file */
-	parsedArgs, err := getArgsFromConfig(configPath)
+	/* Don't bother if the files haven't changed since last time */
+	if cf.configUnchanged(configPaths) {
+		return map[string]string{}, nil
+	}
+	/* Get the keys and values from the config files */
+	deps := newConfigDeps()
+	parsedArgs, err := cf.getArgsFromConfigs(configPaths, deps)
 	if nil != err {
 		return nil, err
 	}
+	if oldFlagValues, err = cf.applyArgs(parsedArgs, true); nil != err {
+		return nil, err
+	}
+	cf.noteConfigDeps(configPaths, deps, parsedArgs)
+	return oldFlagValues, nil
+}
 
+// Set the flags not given on the command line to the values in parsedArgs,
+// or, if resetMissing is true, their defaults if not in parsedArgs.  The new
+// values are worked out and checked before any flag is set.
+func (cf *ConfFlags) applyArgs(parsedArgs []Arg, resetMissing bool) (
+	oldFlagValues map[string]string, err error) {
+	/* Whatever set the flags before, the config should be read again */
+	cf.lastDeps = nil
+	cf.ignored = nil
 	/* Work out which flags weren't specified on the command line */
-	missingFlags := getMissingFlags()
+	p, err := cf.planArgs(parsedArgs, cf.getMissingFlags(), resetMissing,
+		true)
+	if nil != err {
+		return nil, err
+	}
+	warnings, origins, reset := p.warnings, p.origins, p.reset
 
-	/* Old flag values, in case we need to roll back */
-	oldFlagValues = make(map[string]string)
-	/* Sets f to v, saving the old value in oldFlagValues */
-	setIfNotEqual := func(f *flag.Flag, v string) error {
-		/* Previous value */
-		oldvalue := f.Value.String()
-		/* No change if the current value is the default */
-		if oldvalue == v {
-			return nil
-		}
-		/* Save the previous value in case we need to roll back */
-		oldFlagValues[f.Name] = oldvalue
-		/* Try to set the new value */
-		if err := f.Value.Set(v); nil != err {
-			return err
-		}
-		return nil
-	}
-	/* Put values in the config file into variables if they weren't
-	specified on the command line */
-	for _, arg := range parsedArgs {
-		/* Make sure the key from the config file is actually a flag */
-		f := flag.Lookup(arg.Key)
-		if f == nil {
-			err = fmt.Errorf("unknown \"%v\" in line %v of "+
-				"config file %v",
-				arg.Key, arg.LineNum, arg.FilePath)
-			goto Cleanup
-		}
-		/* If the key in the config file wasn't specified on the
-		command line, set it in the variable returne by flag.* */
-		if _, found := missingFlags[f.Name]; found {
-			if err = setIfNotEqual(f, arg.Value); nil != err {
-				err = fmt.Errorf("unable to set %v to %v, "+
-					"from line %v of %v: %v",
-					arg.Key, arg.Value,
-					arg.LineNum, arg.FilePath, err)
-				goto Cleanup
+	/* Flags which may only be set at startup stay as they are */
+	staged, ignored, ws := cf.dropImmutable(p.staged)
+	warnings = append(warnings, ws...)
+	for _, name := range ignored {
+		delete(origins, name)
+		for i, r := range reset {
+			if r == name {
+				reset = append(reset[:i], reset[i+1:]...)
+				break
 			}
-			/* Note that we've set the value */
-			delete(missingFlags, f.Name) /* Not needing setting */
 		}
 	}
 
-	/* Set the rest of the flags missing from the command line and the
-	config file (back) to their default values */
-	for _, f := range missingFlags {
-		if err = setIfNotEqual(f, f.DefValue); nil != err {
-			/* Should never happen */
-			err = fmt.Errorf("unable to set %v to default "+
-				"value %v: %v", f.Name, f.DefValue, err)
+	/* Make sure the new values will do before touching the flags */
+	if err := cf.checkStaged(staged); nil != err {
+		return nil, err
+	}
+	if err := cf.checkVeto(staged); nil != err {
+		return nil, err
+	}
+
+	/* Set the flags, saving the old values in case one we couldn't
+	check won't take its new value and we need to roll back */
+	oldFlagValues = make(map[string]string)
+	for _, s := range staged {
+		/* No change if it's already got the value */
+		oldvalue := s.f.Value.String()
+		if nil == s.vs && (oldvalue == s.v || oldvalue == s.then) {
+			continue
+		}
+		oldFlagValues[s.f.Name] = oldvalue
+		if err = s.set(); nil != err {
+			err = fmt.Errorf("unable to set %v: %v", s.desc,
+				cf.redactErr(s.f.Name, err))
+			break
+		}
+		/* Lists can only be compared once they're set */
+		if nil != s.vs && s.f.Value.String() == oldvalue {
+			delete(oldFlagValues, s.f.Name)
 		}
 	}
-	/* If we encountered an error, reset the values to what was given on
-	the command line */
-Cleanup:
 	if nil != err {
-		// restore old flag values
 		for k, v := range oldFlagValues {
-			flag.Set(k, v)
+			setFlagValue(cf.fs.Lookup(k), v)
 		}
-		oldFlagValues = nil
+		return nil, err
 	}
 
-	return oldFlagValues, err
+	cf.setOrigins(origins, reset)
+	cf.ignored = ignored
+	cf.setExtras(p.extras, resetMissing)
+	cf.handleUnknown(p.unknown)
+	if resetMissing {
+		cf.setRefresh(p.ttl)
+	}
+	cf.warnConfig(warnings, resetMissing)
+	return oldFlagValues, nil
 }
 
-/* flagArg represents a line in the config file */
-type flagArg struct {
+// Resettable is implemented by flag.Values which add to their values on Set,
+// such as lists and maps.  Reset is called before such a value is set from the
+// config file or restored to its default, so that it is replaced and not
+// added to.  Set is not called after Reset if the new value is empty.
+type Resettable interface {
+	flag.Value
+	Reset()
+}
+
+/* setFlagValue sets f to v, resetting it first if it's Resettable */
+func setFlagValue(f *flag.Flag, v string) error {
+	if r, ok := f.Value.(Resettable); ok {
+		r.Reset()
+		if "" == v {
+			return nil
+		}
+	}
+	return f.Value.Set(v)
+}
+
+// Arg is a key/value pair read from a line in a config file.
+type Arg struct {
 	Key      string
 	Value    string
 	FilePath string
 	LineNum  int
+	Section  string /* [Section] in which the line appeared, if any */
+	/* Namespace for the line, from a [tenant:namespace] section */
+	Namespace string
+	/* Where FilePath was #imported, if it was, e.g. "line 2 of a.conf",
+	followed by where that file was imported, and so on */
+	IncludedFrom string
+	/* How Value is used, if the Arg didn't come from the config */
+	kind argKind
+}
+
+/* How an Arg's value is used */
+type argKind int
+
+const (
+	/* Config, which may refer to other flags, files, and secrets */
+	argConfig argKind = iota
+	/* Used as it is, e.g. from the environment */
+	argLiteral
+	/* An @path naming a file with the value, e.g. in the secrets directory */
+	argFile
+)
+
+// location describes where a came from, e.g. line 3 of foo.conf, with the
+// chain of #imports which led there
+func (a Arg) location() string {
+	l := a.FilePath
+	if 0 != a.LineNum {
+		l = fmt.Sprintf("line %v of %v", a.LineNum, a.FilePath)
+	}
+	if "" != a.IncludedFrom {
+		l += ", included from " + a.IncludedFrom
+	}
+	return l
 }
 
-/* Extract the key/value pairs from the config file */
-func getArgsFromConfig(configPath string) ([]flagArg, error) {
+// Extract the key/value pairs from the config file or Source, noting the
+// files read in deps if it's not nil
+func (cf *ConfFlags) getArgsFromConfig(configPath string,
+	deps *configDeps) ([]Arg, error) {
+	if args, err := cf.readSource(configPath); errNotASource != err {
+		return args, err
+	}
+	return cf.readConfigFile(configPath, nil, deps)
+}
+
+// Extract the key/value pairs from the config file, which was imported by
+// the files in importStack
+func (cf *ConfFlags) readConfigFile(configPath string, importStack []string,
+	deps *configDeps) ([]Arg, error) {
+	/* Note the file's version before we read it */
+	deps.addFile(configPath)
 	/* Open the config file */
 	file, err := os.Open(configPath)
 	if file == nil {
 		return nil, err
 	}
 	defer file.Close()
-	r := bufio.NewScanner(file)
+	/* Files in other formats are recognized by their extensions, unless
+	-configFormat says otherwise for the -config file itself */
+	name := formatNameForPath(configPath)
+	if 0 == len(importStack) && "" != *cf.configFormat {
+		name = *cf.configFormat
+	}
+	if "" == name || "conf" == name {
+		return cf.readConfig(file, file.Name(), importStack, deps)
+	}
+	f := LookupFormat(name)
+	if nil == f {
+		return nil, fmt.Errorf("unknown config format %q", name)
+	}
+	return f.Read(file, file.Name())
+}
+
+// ReadConfig reads the key/value pairs in config file format from rd without
+// applying them to any flags.  name is used as the FilePath of the returned
+// Args and as the path against which relative #import paths are resolved.
+// The output of -dumpflags may also be read with ReadConfig.  Sections are
+// mapped as set with MapSection.
+func ReadConfig(rd io.Reader, name string) ([]Arg, error) {
+	return std.ReadConfig(rd, name)
+}
+
+// ReadConfig is like the package-level ReadConfig, but maps sections as set
+// with cf.MapSection.
+func (cf *ConfFlags) ReadConfig(rd io.Reader, name string) ([]Arg, error) {
+	return cf.readConfig(rd, name, nil, nil)
+}
+
+// readConfig does the work for ReadConfig.  importStack holds the files
+// which imported name.  Imported files are noted in deps if it's not nil.
+func (cf *ConfFlags) readConfig(rd io.Reader, name string,
+	importStack []string, deps *configDeps) ([]Arg, error) {
+	r := bufio.NewScanner(rd)
 
 	/* Read lines from the config file */
-	args := []flagArg{}
+	args := []Arg{}
 	lineNum := 0
+	section := "" /* Current [section] */
+	/* Keys renamed by #rename */
+	renames := make(map[string]string)
+	commentChar := cf.getCommentChar()
 	for r.Scan() {
 		/* Note where we are in config file */
 		lineNum++
 		line := r.Text()
 		/* Trim trailing and leading spaces */
 		line = strings.TrimSpace(line)
+		/* Lines ending in \ continue on the next line */
+		start := lineNum
+		line, n := continueLine(r, line, commentChar)
+		lineNum += n
+		/* Pull in other files */
+		if isImport(line) {
+			ias, err := cf.importConfig(line, name, start,
+				importStack, deps)
+			if nil != err {
+				return nil, err
+			}
+			args = append(args, ias...)
+			continue
+		}
+		/* Rename keys in the rest of the file */
+		if isDirective(line, "#rename") {
+			o, n, err := parseRename(line, name, start)
+			if nil != err {
+				return nil, err
+			}
+			renames[o] = n
+			continue
+		}
 		/* Ignore blank lines and comments */
-		if "" == line || strings.HasPrefix(line, "#") {
+		if line = stripComment(line, commentChar); "" == line ||
+			strings.HasPrefix(line, "#") {
 			continue
 		}
+		/* Note the start of a section */
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		/* Lines pasted from a command line start with - or -- */
+		cli := strings.HasPrefix(line, "-")
+		if cli {
+			line = strings.TrimPrefix(line[1:], "-")
+		}
 		/* Split into key and value */
 		parts := splitRE.Split(line, 2)
 		var key, value string /* Key and value from config file */
 		key = strings.TrimSpace(parts[0])
 		/* If the value isn't specified, hope it's a boolean */
-		if 1 == len(parts) {
+		if i := strings.Index(key, "="); cli && -1 != i {
+			key, value = key[:i], line[i+1:]
+		} else if 1 == len(parts) {
 			value = "true"
 		} else {
 			value = parts[1]
 		}
+		/* Heredocs run until their terminator, and quotes keep
+		leading and trailing spaces */
+		var err error
+		if m := heredocRE.FindStringSubmatch(value); nil != m && !cli {
+			var ok bool
+			value, n, ok = readHeredoc(r, m[1])
+			lineNum += n
+			if !ok {
+				return nil, fmt.Errorf("unterminated %v in "+
+					"line %v of %v", m[0], start, name)
+			}
+		} else if value, err = unquoteValue(value); nil != err {
+			return nil, fmt.Errorf("%v in line %v of %v", err,
+				start, name)
+		}
+		/* Keys in a section may have different names, except in
+		namespaces, which use the flag names */
+		namespace := sectionNamespace(section)
+		if "" != section && "" == namespace {
+			key = cf.sectionKey(section, key)
+		}
+		if n, ok := renames[key]; ok {
+			key = n
+		}
 		/* Not that we have the flag */
-		args = append(args, flagArg{
-			Key:      key,
-			Value:    value,
-			FilePath: file.Name(),
-			LineNum:  lineNum,
+		args = append(args, Arg{
+			Key:       key,
+			Value:     value,
+			FilePath:  name,
+			LineNum:   start,
+			Section:   section,
+			Namespace: namespace,
 		})
 	}
 	/* Scanner error? */
@@ -364,31 +1216,20 @@ func getArgsFromConfig(configPath string) ([]flagArg, error) {
 
 /* getMissingFlags returns a hash of flags which were not specified on the
 command line.  All values in the hash are true. */
-func getMissingFlags() map[string]*flag.Flag {
+func (cf *ConfFlags) getMissingFlags() map[string]*flag.Flag {
 	/* Work out which flags have been set on the command line */
 	setFlags := make(map[string]bool)
-	flag.Visit(func(f *flag.Flag) {
+	cf.fs.Visit(func(f *flag.Flag) {
 		setFlags[f.Name] = true
 	})
 
 	/* Work out which flags haven't */
 	missingFlags := make(map[string]*flag.Flag)
-	flag.VisitAll(func(f *flag.Flag) {
-		if _, ok := setFlags[f.Name]; !ok {
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		/* -config says where the config is, so can't come from it */
+		if _, ok := setFlags[f.Name]; !ok && "config" != f.Name {
 			missingFlags[f.Name] = f
 		}
 	})
 	return missingFlags
 }
-
-/* Print the current state of the flags (key/value pairs) in ini format */
-func dumpFlags() {
-	flag.VisitAll(func(f *flag.Flag) {
-		if f.Name != "config" && f.Name != "dumpflags" {
-			fmt.Printf("# %s\n", strings.Replace(
-				strings.Replace(f.Usage, "\r\n", "\n", -1),
-				"\n", "\n#\t", -1))
-			fmt.Printf("%s %s\n", f.Name, f.Value.String())
-		}
-	})
-}
@@ -0,0 +1,48 @@
+package confflags
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// Credential marks a flag as one which is set from the systemd credential
+// with the given name, or the flag's name if name is "", e.g. one loaded with
+// LoadCredential= in the unit file.  When $CREDENTIALS_DIRECTORY is set, the
+// credential's file in that directory, if it exists, sets the flag, less
+// leading and trailing whitespace, as described for SetSecretsDir.
+// Credentials are usually also Secret.
+func Credential(name string) Annotation {
+	return Annotation{credentialKey, name}
+}
+
+// credentialArgs returns Args for the flags annotated with Credential whose
+// credentials are in $CREDENTIALS_DIRECTORY.  The Args' values are of the
+// form @path, so the files are read as other @path values are.
+func (cf *ConfFlags) credentialArgs() []Arg {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if "" == dir {
+		return nil
+	}
+	var args []Arg
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		name, ok := cf.Annotations(f.Name)[credentialKey]
+		if !ok {
+			return
+		}
+		if "" == name {
+			name = f.Name
+		}
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); nil != err || fi.IsDir() {
+			return
+		}
+		args = append(args, Arg{
+			Key:      f.Name,
+			Value:    "@" + path,
+			FilePath: path,
+			kind:     argFile,
+		})
+	})
+	return args
+}
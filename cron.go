@@ -0,0 +1,183 @@
+package confflags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Usage for -configUpdateSchedule */
+const configUpdateScheduleUsage = "Cron-style schedule (minute hour " +
+	"day-of-month month day-of-week, e.g. \"0 3 * * *\" for 3am every " +
+	"day) on which to re-read the config file set via -config flag, in " +
+	"addition to -configUpdateInterval."
+
+/* scheduleValue is a flag.Value holding a cron schedule */
+type scheduleValue struct {
+	s     string
+	sched *cronSchedule
+	lock  sync.Mutex
+}
+
+func (v *scheduleValue) String() string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.s
+}
+
+func (v *scheduleValue) Set(s string) error {
+	var sched *cronSchedule
+	if "" != strings.TrimSpace(s) {
+		var err error
+		if sched, err = parseCron(s); nil != err {
+			return err
+		}
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.s, v.sched = s, sched
+	return nil
+}
+
+/* get returns the schedule, or nil if there isn't one */
+func (v *scheduleValue) get() *cronSchedule {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.sched
+}
+
+/* cronSchedule is a parsed cron expression.  Each field is a bitmask. */
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool /* Day fields were * */
+}
+
+/* parseCron parses a five-field cron expression */
+func parseCron(s string) (*cronSchedule, error) {
+	fields := strings.Fields(s)
+	if 5 != len(fields) {
+		return nil, fmt.Errorf("schedule %q does not have 5 fields", s)
+	}
+	c := &cronSchedule{}
+	var err error
+	for _, f := range []struct {
+		mask     *uint64
+		s        string
+		min, max int
+	}{
+		{&c.minute, fields[0], 0, 59},
+		{&c.hour, fields[1], 0, 23},
+		{&c.dom, fields[2], 1, 31},
+		{&c.month, fields[3], 1, 12},
+		{&c.dow, fields[4], 0, 7},
+	} {
+		if *f.mask, err = parseCronField(f.s, f.min, f.max); nil != err {
+			return nil, fmt.Errorf("schedule %q: %v", s, err)
+		}
+	}
+	/* Sunday is both 0 and 7 */
+	if 0 != c.dow&(1<<7) {
+		c.dow |= 1
+	}
+	c.domStar = "*" == fields[2]
+	c.dowStar = "*" == fields[4]
+	return c, nil
+}
+
+// parseCronField parses one field of a cron expression, which is a comma-
+// separated list of *, n, or n-m, each optionally followed by /step.
+func parseCronField(s string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(s, ",") {
+		/* Work out the step */
+		step := 1
+		if i := strings.Index(part, "/"); -1 != i {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if nil != err || 0 >= step {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+		/* Work out the range */
+		lo, hi := min, max
+		if "*" != part {
+			var err error
+			r := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(r[0]); nil != err {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if 2 == len(r) {
+				if hi, err = strconv.Atoi(r[1]); nil != err {
+					return 0, fmt.Errorf("invalid value "+
+						"%q", part)
+				}
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q out of range %v-%v",
+					part, min, max)
+			}
+		}
+		for i := lo; i <= hi; i += step {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask, nil
+}
+
+/* next returns the first time after t which matches the schedule */
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	/* Give up after a few years, e.g. for February 31st */
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case 0 == c.month&(1<<uint(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0,
+				t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0,
+				0, t.Location())
+		case 0 == c.hour&(1<<uint(t.Hour())):
+			t = nextHour(t)
+		case 0 == c.minute&(1<<uint(t.Minute())):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return limit
+}
+
+// nextHour returns the start of the hour after t's, in t's location.  Unlike
+// with Truncate, which works in UTC, this works in zones which aren't a whole
+// number of hours from UTC.
+func nextHour(t time.Time) time.Time {
+	n := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0,
+		t.Location())
+	/* Date goes back an hour for times skipped by daylight saving time */
+	if !n.After(t) {
+		n = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+	}
+	return n
+}
+
+// dayMatches reports whether t's day matches the schedule.  As with cron, if
+// both the day of the month and the day of the week are restricted, either
+// may match.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := 0 != c.dom&(1<<uint(t.Day()))
+	dow := 0 != c.dow&(1<<uint(t.Weekday()))
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,50 @@
+package confflags
+
+import "fmt"
+
+/* Functions which compute flags' defaults, by flag name */
+type defaultState struct {
+	defaultFuncs map[string]func() string
+}
+
+func (s *defaultState) init() {
+	s.defaultFuncs = make(map[string]func() string)
+}
+
+// SetDefaultFunc registers a function which computes the default value of the
+// named flag when Parse is called, e.g. a number of workers based on
+// runtime.NumCPU.  The computed default is used if the flag is set neither on
+// the command line nor in the config file, and is shown in usage messages
+// and by -dumpflags.  SetDefaultFunc must be called before Parse.
+func SetDefaultFunc(name string, fn func() string) error {
+	return std.SetDefaultFunc(name, fn)
+}
+
+// SetDefaultFunc registers a function which computes the default value of
+// the named flag when cf.Parse is called.  See the package-level
+// SetDefaultFunc.
+func (cf *ConfFlags) SetDefaultFunc(name string, fn func() string) error {
+	if cf.parsed {
+		return fmt.Errorf("flags already parsed")
+	}
+	if nil == cf.fs.Lookup(name) {
+		return fmt.Errorf("cannot set default function for "+
+			"non-existant flag %v", name)
+	}
+	cf.defaultFuncs[name] = fn
+	return nil
+}
+
+/* applyDefaultFuncs computes flags' defaults and sets the flags to them */
+func (cf *ConfFlags) applyDefaultFuncs() error {
+	for name, fn := range cf.defaultFuncs {
+		f := cf.fs.Lookup(name)
+		v := fn()
+		if err := setFlagValue(f, v); nil != err {
+			return fmt.Errorf("unable to set %v to computed "+
+				"default value %v: %v", name, v, err)
+		}
+		f.DefValue = v
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+/* Deprecated flag names, mapped to the names of the flags replacing them */
+type deprecationState struct {
+	deprecated map[string]string
+}
+
+func (s *deprecationState) init() {
+	s.deprecated = make(map[string]string)
+}
+
+// Deprecate makes old, the name of a flag which has been renamed, another
+// name for the flag named new in flag.CommandLine.  Setting old on the
+// command line, in the config file, or in the environment sets new instead,
+// with a Warning saying where old was used.  new must already be defined, old
+// mustn't be, and Deprecate must be called before Parse.  old is left out of
+// PrintGroupedDefaults, and -dumpflags only names it in a comment.
+func Deprecate(old, new string) error {
+	return std.Deprecate(old, new)
+}
+
+// Deprecate makes old another name for the flag named new in cf's FlagSet.
+// See the package-level Deprecate.
+func (cf *ConfFlags) Deprecate(old, new string) error {
+	if cf.parsed {
+		return fmt.Errorf("flags already parsed")
+	}
+	f := cf.fs.Lookup(new)
+	if nil == f {
+		return fmt.Errorf("cannot deprecate %v in favor of "+
+			"non-existent flag %v", old, new)
+	}
+	if nil != cf.fs.Lookup(old) {
+		return fmt.Errorf("cannot deprecate %v, which is still a flag",
+			old)
+	}
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	cf.fs.Var(&aliasValue{isBool: ok && b.IsBoolFlag()}, old,
+		fmt.Sprintf("Deprecated; use -%v instead.", new))
+	cf.deprecated[old] = new
+	return cf.Annotate(old, Hidden())
+}
+
+// aliasValue is the Value of a deprecated flag.  It only holds what was given
+// on the command line until it's passed on to the flag which replaced it.
+type aliasValue struct {
+	vs     []string /* Every value given, for Appenders */
+	isBool bool
+}
+
+/* String returns the last value given */
+func (v *aliasValue) String() string {
+	if 0 == len(v.vs) {
+		return ""
+	}
+	return v.vs[len(v.vs)-1]
+}
+
+func (v *aliasValue) Set(s string) error {
+	v.vs = append(v.vs, s)
+	return nil
+}
+
+func (v *aliasValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+/* deprecationWarning returns a Warning that arg uses a deprecated name */
+func deprecationWarning(arg Arg, new string) Warning {
+	return Warning{arg, fmt.Sprintf("%v is deprecated in favor of %v",
+		arg.Key, new)}
+}
+
+// setDeprecatedFlags sets the flags replacing the deprecated flags given on
+// the command line, unless they were given as well.  Every value given for a
+// deprecated flag is appended to a replacement whose Value is an Appender,
+// after those given with its new name.
+func (cf *ConfFlags) setDeprecatedFlags() error {
+	onCL := make(map[string]string)
+	cf.fs.Visit(func(f *flag.Flag) {
+		onCL[f.Name] = f.Value.String()
+	})
+	olds := make([]string, 0, len(cf.deprecated))
+	for old := range cf.deprecated {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	var ws []Warning
+	for _, old := range olds {
+		new := cf.deprecated[old]
+		v, ok := onCL[old]
+		if !ok {
+			continue
+		}
+		ws = append(ws, deprecationWarning(Arg{
+			Key:      old,
+			Value:    v,
+			FilePath: "command line",
+		}, new))
+		_, given := onCL[new]
+		if isAppender(cf.fs.Lookup(new)) {
+			if err := cf.appendAlias(new, old, given); nil != err {
+				return fmt.Errorf("unable to add to %v values "+
+					"given as deprecated %v: %v", new, old,
+					err)
+			}
+			continue
+		}
+		if given {
+			continue
+		}
+		if err := cf.fs.Set(new, v); nil != err {
+			return fmt.Errorf("unable to set %v to %v, given as "+
+				"deprecated %v: %v", new, v, old, err)
+		}
+	}
+	cf.warn(ws)
+	return nil
+}
+
+// appendAlias passes the values given for the deprecated flag old to the
+// flag new, whose Value is an Appender.  Unless new was given on the command
+// line as well, the first value is given to Set, which marks new as set on
+// the command line, and the rest are appended.
+func (cf *ConfFlags) appendAlias(new, old string, given bool) error {
+	vs := cf.fs.Lookup(old).Value.(*aliasValue).vs
+	if !given {
+		if err := cf.fs.Set(new, vs[0]); nil != err {
+			return err
+		}
+		vs = vs[1:]
+	}
+	a := cf.fs.Lookup(new).Value.(Appender)
+	for _, v := range vs {
+		if err := a.Append(v); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameDeprecated returns args with deprecated keys replaced by the names of
+// the flags replacing them, and warnings about each
+func (cf *ConfFlags) renameDeprecated(args []Arg) ([]Arg, []Warning) {
+	if 0 == len(cf.deprecated) {
+		return args, nil
+	}
+	var ws []Warning
+	out := make([]Arg, len(args))
+	for i, arg := range args {
+		if new, ok := cf.deprecated[arg.Key]; ok {
+			ws = append(ws, deprecationWarning(arg, new))
+			arg.Key = new
+		}
+		out[i] = arg
+	}
+	return out, ws
+}
@@ -0,0 +1,149 @@
+package confflags
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// configDeps notes the files read for the config and the import patterns
+// used to find them, so that re-reading the config can be skipped if none of
+// them have changed.  A nil *configDeps notes nothing.
+type configDeps struct {
+	files map[string]fileDep  /* By path */
+	globs map[string][]string /* Matching files, by pattern */
+}
+
+/* fileDep is the version of a file which was read */
+type fileDep struct {
+	stamp fileStamp
+	hash  [sha256.Size]byte /* Zero if the file couldn't be read */
+}
+
+func newConfigDeps() *configDeps {
+	return &configDeps{
+		files: make(map[string]fileDep),
+		globs: make(map[string][]string),
+	}
+}
+
+/* addFile notes that the file at path was, or was to be, read */
+func (d *configDeps) addFile(path string) {
+	if nil == d {
+		return
+	}
+	d.files[path] = fileDep{stamp: stampFile(path), hash: hashFile(path)}
+}
+
+/* addGlob notes that pattern matched the files in matches */
+func (d *configDeps) addGlob(pattern string, matches []string) {
+	if nil == d {
+		return
+	}
+	d.globs[pattern] = matches
+}
+
+// changed reports whether any of the files have changed or any of the
+// patterns match different files.  A file with a new stamp but the same
+// contents, e.g. because it was touched, is given the new stamp.
+func (d *configDeps) changed() bool {
+	for pattern, matches := range d.globs {
+		m, _ := filepath.Glob(pattern)
+		if strings.Join(m, "\x00") != strings.Join(matches, "\x00") {
+			return true
+		}
+	}
+	for path, f := range d.files {
+		s := stampFile(path)
+		if s.same(f.stamp) {
+			continue
+		}
+		if hashFile(path) != f.hash {
+			return true
+		}
+		d.files[path] = fileDep{stamp: s, hash: f.hash}
+	}
+	return false
+}
+
+/* hashFile returns the hash of the file at path, or zero on error */
+func hashFile(path string) [sha256.Size]byte {
+	b, err := ioutil.ReadFile(path)
+	if nil != err {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(b)
+}
+
+// depsState holds what was read the last time the config was applied, if
+// the next read may be skipped when it's unchanged.  It's guarded by
+// updateLock.
+type depsState struct {
+	lastPaths     []string
+	lastNamespace string
+	lastDeps      *configDeps /* nil if the next read mustn't be skipped */
+}
+
+// configUnchanged reports whether the config files at paths were the ones
+// last applied and haven't changed since
+func (cf *ConfFlags) configUnchanged(paths []string) bool {
+	if nil == cf.lastDeps || cf.Namespace() != cf.lastNamespace ||
+		strings.Join(paths, "\x00") != strings.Join(cf.lastPaths,
+			"\x00") {
+		return false
+	}
+	return !cf.lastDeps.changed()
+}
+
+// noteConfigDeps notes that args, read from paths, which depended on deps,
+// have been applied.  If reading them again might give different values even
+// if the files are unchanged, because of the environment, Sources, or
+// references resolved with a Resolver, the next read won't be skipped.  Files
+// named by @path values and those in the secrets directory and systemd's
+// credentials directory are noted with the config files.
+func (cf *ConfFlags) noteConfigDeps(paths []string, deps *configDeps,
+	args []Arg) {
+	cf.lastDeps = nil
+	if cf.usingEnv() || "" != *cf.envfile {
+		return
+	}
+	for _, path := range paths {
+		if isSourceURL(path) {
+			return
+		}
+	}
+	for _, arg := range args {
+		if isReference(arg.Value) || cf.refersToEnv(arg.Value) {
+			return
+		}
+		if path, ok := valueFile(arg); ok {
+			/* Which file isn't known until it's interpolated */
+			if strings.Contains(path, "${") {
+				return
+			}
+			deps.addFile(path)
+		}
+	}
+	cf.noteSecretsDir(deps)
+	for _, arg := range cf.credentialArgs() {
+		path, _ := valueFile(arg)
+		deps.addFile(path)
+	}
+	cf.lastPaths = paths
+	cf.lastNamespace = cf.Namespace()
+	cf.lastDeps = deps
+}
+
+// refersToEnv reports whether v has a ${name} which would be taken from the
+// environment, as name isn't a flag
+func (cf *ConfFlags) refersToEnv(v string) bool {
+	env := false
+	expandRefs(v, func(name string) (string, error) {
+		if nil == cf.fs.Lookup(name) {
+			env = true
+		}
+		return "", nil
+	})
+	return env
+}
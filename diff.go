@@ -0,0 +1,134 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// Change describes a flag whose value differs between two config files.
+type Change struct {
+	Name string /* Flag name */
+	Old  string /* Value from the first file, or the default */
+	New  string /* Value from the second file, or the default */
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%v: %q -> %q", c.Name, c.Old, c.New)
+}
+
+// DiffFiles reads the config files a and b and returns the flags which would
+// have different values if b were used as the config file instead of a,
+// sorted by flag name.  Flags not in a file are taken to have their default
+// values.  Values are compared as the flags would report them once set, so
+// 1m and 60s for a duration aren't a change, and @file and other references
+// are resolved.  Nothing is applied to the flags.  An error is returned if either
+// file can't be read or refers to an unknown flag.
+func DiffFiles(a, b string) ([]Change, error) {
+	return std.DiffFiles(a, b)
+}
+
+// DiffFiles is like the package-level DiffFiles, but for the flags in cf's
+// FlagSet.
+func (cf *ConfFlags) DiffFiles(a, b string) ([]Change, error) {
+	av, err := cf.fileValues(a)
+	if nil != err {
+		return nil, err
+	}
+	bv, err := cf.fileValues(b)
+	if nil != err {
+		return nil, err
+	}
+	changes := []Change{}
+	for name, old := range av {
+		if bv[name] != old {
+			changes = append(changes, Change{
+				Name: name,
+				Old:  cf.redactValue(name, old),
+				New:  cf.redactValue(name, bv[name]),
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// fileValues returns the values every flag would report with the config
+// files at paths, ignoring the command line and the environment.  Values
+// are as they would be once set, e.g. 1m0s for a 1m duration.
+func (cf *ConfFlags) fileValues(paths ...string) (map[string]string, error) {
+	args, err := cf.getArgsFromConfigs(paths, nil)
+	if nil != err {
+		return nil, err
+	}
+	vals := make(map[string]string)
+	all := make(map[string]*flag.Flag)
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		if "config" != f.Name {
+			all[f.Name] = f
+		}
+	})
+	p, err := cf.planArgs(args, all, true, false)
+	if nil != err {
+		return nil, err
+	}
+	if err := cf.normalizeStaged(p.staged); nil != err {
+		return nil, err
+	}
+	for _, s := range p.staged {
+		vals[s.f.Name] = s.then
+	}
+	return vals, nil
+}
+
+// Preview returns the UpdateResult which would be produced by reading the
+// config file at path, or the current config files if path is "", without
+// changing any flags or calling any callbacks.  The config is put through
+// everything a reload would do, including the environment, @file and other
+// references, and validators, and new values are as the flags would report
+// them once set (e.g. true, for a boolean flag set to 1).
+func Preview(path string) (UpdateResult, error) {
+	return std.Preview(path)
+}
+
+// Preview returns the UpdateResult which would be produced by reading the
+// config file at path, or cf's config files if path is "".  See the
+// package-level Preview.
+func (cf *ConfFlags) Preview(path string) (UpdateResult, error) {
+	/* Keep reloads and setters from changing things part way through */
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	paths := []string{path}
+	if "" == path {
+		paths = cf.configPaths()
+	}
+	args, err := cf.getArgsFromConfigs(paths, nil)
+	if nil != err {
+		return UpdateResult{}, err
+	}
+	p, err := cf.planArgs(args, cf.getMissingFlags(), true, true)
+	if nil != err {
+		return UpdateResult{}, err
+	}
+	staged, ignored, _ := cf.dropImmutable(p.staged)
+	if err := cf.checkStaged(staged); nil != err {
+		return UpdateResult{}, err
+	}
+	changed := make(map[string]string)
+	old := make(map[string]string)
+	for _, s := range staged {
+		if cur := s.f.Value.String(); cur != s.then {
+			changed[s.f.Name] = s.then
+			old[s.f.Name] = cur
+		}
+	}
+	restart, _ := cf.splitRestartRequired(old)
+	return UpdateResult{
+		ChangedFlags:    cf.redactValues(changed),
+		OldValues:       cf.redactValues(old),
+		RestartRequired: restart,
+		Ignored:         ignored,
+	}, nil
+}
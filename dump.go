@@ -0,0 +1,268 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DumpHandler is called by Parse with the output of -dumpflags.  Parse
+// returns whatever the DumpHandler returns.
+type DumpHandler func(dump []byte) error
+
+/* What to do with -dumpflags output */
+type dumpState struct {
+	dumpHandler DumpHandler
+	dumpLock    sync.Mutex
+}
+
+func (s *dumpState) init() {
+	s.dumpHandler = PrintDump
+}
+
+// SetDumpHandler changes what Parse does with the output of -dumpflags.  The
+// default is PrintDump.  Setting a nil handler restores the default.
+func SetDumpHandler(h DumpHandler) {
+	std.SetDumpHandler(h)
+}
+
+// SetDumpHandler changes what cf.Parse does with the output of -dumpflags.
+// The default is PrintDump.  Setting a nil handler restores the default.
+func (cf *ConfFlags) SetDumpHandler(h DumpHandler) {
+	cf.dumpLock.Lock()
+	defer cf.dumpLock.Unlock()
+	if nil == h {
+		h = PrintDump
+	}
+	cf.dumpHandler = h
+}
+
+// PrintDump is a DumpHandler which prints the dump to stdout and returns
+// DumpedFlags.
+func PrintDump(dump []byte) error {
+	if _, err := os.Stdout.Write(dump); nil != err {
+		return err
+	}
+	return DumpedFlags
+}
+
+// ExitAfterDump is a DumpHandler which prints the dump to stdout and exits
+// the program with status 0, by way of ExitFunc.
+func ExitAfterDump(dump []byte) error {
+	if _, err := os.Stdout.Write(dump); nil != err {
+		return err
+	}
+	ExitFunc(0)
+	return nil
+}
+
+/* handleDump passes dump to the DumpHandler */
+func (cf *ConfFlags) handleDump(dump []byte) error {
+	cf.dumpLock.Lock()
+	h := cf.dumpHandler
+	cf.dumpLock.Unlock()
+	return h(dump)
+}
+
+// dumpValue is the value of -dumpflags, which may be a boolean or the name of
+// the format in which to dump the flags
+type dumpValue struct {
+	dump   bool
+	format string /* "" for the default */
+	lock   sync.Mutex
+}
+
+func (v *dumpValue) String() string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if !v.dump {
+		return "false"
+	} else if "" == v.format {
+		return "true"
+	}
+	return v.format
+}
+
+func (v *dumpValue) Set(s string) error {
+	dump, format := true, s
+	if b, err := strconv.ParseBool(s); nil == err {
+		dump, format = b, ""
+	} else if "ini" == s {
+		format = "conf"
+	} else if nil == LookupFormat(s) {
+		return fmt.Errorf("unknown format %q", s)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.dump, v.format = dump, format
+	return nil
+}
+
+func (v *dumpValue) IsBoolFlag() bool {
+	return true
+}
+
+// get returns whether the flags are to be dumped, and in which format, or ""
+// for the default
+func (v *dumpValue) get() (bool, string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.dump, v.format
+}
+
+// dumpFormat returns the format in which to dump the flags, or "" if they
+// aren't to be dumped.  The other -dumpflags* flags imply -dumpflags, in the
+// format named by -dumpflagsOut's extension if no other was given.
+func (cf *ConfFlags) dumpFormat() string {
+	dump, format := cf.dumpflags.get()
+	out := *cf.dumpflagsOut
+	if !dump && "" == out && !*cf.dumpflagsNonDefault &&
+		!*cf.dumpflagsSources {
+		return ""
+	}
+	if "" == format && "" != out {
+		format = formatNameForPath(out)
+	}
+	if "" == format {
+		format = "conf"
+	}
+	return format
+}
+
+/* isDumpFlag returns true for the flags which ask for a dump */
+func isDumpFlag(name string) bool {
+	return "dumpflags" == name || "dumpflagsOut" == name ||
+		"dumpflagsNonDefault" == name || "dumpflagsSources" == name
+}
+
+// writeDumpFile writes dump to the file at path, by way of a temporary file
+// in the same directory so a partial dump is never seen.  As the dump may
+// hold sensitive config, the file is only readable by its owner.
+func writeDumpFile(path string, dump []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path),
+		"."+filepath.Base(path)+".")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(dump); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); nil != err {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// dumpFlags writes the current state of the flags (key/value pairs) to w in
+// the named format.  The default format, conf, notes each flag's usage in a
+// comment.  With -dumpflagsNonDefault, only flags which differ from their
+// defaults are written, with the defaults in comments.  With
+// -dumpflagsSources, where each flag got its value is noted in a comment.
+// Hidden and deprecated flags aren't written, but a full dump in the conf
+// format names them in comments for ReadSchema, which also reads comments
+// noting list flags.
+func (cf *ConfFlags) dumpFlags(w io.Writer, format string) error {
+	nonDefault := *cf.dumpflagsNonDefault
+	sources := *cf.dumpflagsSources
+	flags := []*flag.Flag{}
+	hidden := []string{}
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		if "config" == f.Name || isDumpFlag(f.Name) {
+			return
+		}
+		if cf.isAnnotated(f.Name, hiddenKey) {
+			hidden = append(hidden, f.Name)
+			return
+		}
+		if nonDefault && f.Value.String() == f.DefValue {
+			return
+		}
+		flags = append(flags, f)
+	})
+
+	/* Other formats get just the values */
+	if "conf" != format {
+		fm := LookupFormat(format)
+		if nil == fm {
+			return fmt.Errorf("unknown format %q", format)
+		}
+		args := make([]Arg, 0, len(flags))
+		for _, f := range flags {
+			args = append(args, Arg{
+				Key:   f.Name,
+				Value: cf.dumpedValue(f),
+			})
+		}
+		return fm.Write(w, args)
+	}
+
+	for _, f := range flags {
+		fmt.Fprintf(w, "# %s\n", strings.Replace(
+			strings.Replace(f.Usage, "\r\n", "\n", -1),
+			"\n", "\n#\t", -1))
+		if n := cf.usageNote(f.Name); "" != n {
+			fmt.Fprintf(w, "#%s\n", n)
+		}
+		if isAppender(f) {
+			fmt.Fprintf(w, "%s%s may be given more than once\n",
+				listMarker, f.Name)
+		}
+		if nonDefault {
+			fmt.Fprintf(w, "# Default: %s\n", cf.redactValue(f.Name,
+				f.DefValue))
+		}
+		if sources {
+			fmt.Fprintf(w, "# Source: %s\n", cf.FlagSource(f.Name))
+		}
+		fmt.Fprintf(w, "%s %s\n", f.Name, quoteValue(cf.dumpedValue(f),
+			cf.getCommentChar()))
+	}
+
+	/* Note the flags which may be set but aren't shown, so the dump can
+	still be used as a schema */
+	if nonDefault {
+		return nil
+	}
+	for _, n := range hidden {
+		if new, ok := cf.deprecated[n]; ok {
+			fmt.Fprintf(w, "%s%s in favor of %s\n", deprecatedMarker,
+				n, new)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s\n", hiddenMarker, n)
+		if isAppender(cf.fs.Lookup(n)) {
+			fmt.Fprintf(w, "%s%s may be given more than once\n",
+				listMarker, n)
+		}
+	}
+	return nil
+}
+
+// dumpedValue returns f's value as it's dumped, escaped so it isn't taken
+// for a reference when it's read back, or, for a secret, ***** or a
+// placeholder
+func (cf *ConfFlags) dumpedValue(f *flag.Flag) string {
+	if !cf.isAnnotated(f.Name, secretKey) {
+		return escapeValue(f.Value.String())
+	}
+	p := cf.annotation(f.Name, placeholderKey)
+	if "" == p {
+		p = cf.envName(f.Name)
+	}
+	if "" != p {
+		return "${" + p + "}"
+	}
+	return "*****"
+}
@@ -0,0 +1,190 @@
+package confflags
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/* Prefix for environment variables which set flags */
+type envState struct {
+	envPrefix string
+	envLock   sync.Mutex
+}
+
+// SetEnvPrefix causes flags in flag.CommandLine to be set from environment
+// variables whose names are prefix, an underscore, and the flag's name in
+// upper case with anything other than letters and digits replaced by
+// underscores.  For example, with
+//
+//	confflags.SetEnvPrefix("MYAPP")
+//
+// MYAPP_HTTP_PORT sets -http.port.  Values from the environment override
+// those in the config file, but not those on the command line.  The
+// environment is read whenever the config file is.  An empty prefix, the
+// default, turns this off.
+//
+// Variables may also be put in a dotenv-style file of KEY=value lines, given
+// with -envfile or, if there's no -envfile, read from .env if it exists.
+// Variables in the environment override those in the file.  Without a
+// prefix, -envfile's variables are the flag names, e.g. HTTP_PORT.  Values
+// are used as they are, so @path, ${name}, and other references aren't
+// resolved.  Secret flags without a Placeholder are written by -dumpflags
+// as ${variable}.
+func SetEnvPrefix(prefix string) {
+	std.SetEnvPrefix(prefix)
+}
+
+// SetEnvPrefix causes flags in cf's FlagSet to be set from environment
+// variables starting with prefix.  See the package-level SetEnvPrefix.
+func (cf *ConfFlags) SetEnvPrefix(prefix string) {
+	cf.envLock.Lock()
+	defer cf.envLock.Unlock()
+	cf.envPrefix = prefix
+}
+
+/* usingEnv reports whether flags are set from the environment */
+func (s *envState) usingEnv() bool {
+	s.envLock.Lock()
+	defer s.envLock.Unlock()
+	return "" != s.envPrefix
+}
+
+// envName returns the name of the environment variable for the named flag,
+// or "" if flags aren't set from the environment
+func (s *envState) envName(name string) string {
+	s.envLock.Lock()
+	prefix := s.envPrefix
+	s.envLock.Unlock()
+	if "" == prefix {
+		return ""
+	}
+	return envVarName(prefix, name)
+}
+
+// envVarName returns the name of the environment variable with the given
+// prefix for the named flag.  The prefix may be empty.
+func envVarName(prefix, name string) string {
+	n := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+	if "" == prefix {
+		return n
+	}
+	return prefix + "_" + n
+}
+
+// envArgs returns Args for the flags set in the environment and in the
+// -envfile file, with those from the environment last
+func (cf *ConfFlags) envArgs() ([]Arg, error) {
+	args, err := cf.envFileArgs()
+	if nil != err {
+		return nil, err
+	}
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		n := cf.envName(f.Name)
+		if "" == n {
+			return
+		}
+		if v, ok := os.LookupEnv(n); ok {
+			args = append(args, Arg{
+				Key:      f.Name,
+				Value:    v,
+				FilePath: "$" + n,
+				kind:     argLiteral,
+			})
+		}
+	})
+	return args, nil
+}
+
+// envFileArgs returns Args for the flags set in the -envfile file, or in
+// .env if there's no -envfile and flags are set from the environment.
+// Variables which don't set flags are ignored.
+func (cf *ConfFlags) envFileArgs() ([]Arg, error) {
+	/* Work out which file to read, if any */
+	path := *cf.envfile
+	if "" == path {
+		if !cf.usingEnv() {
+			return nil, nil
+		}
+		path = ".env"
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	f, err := os.Open(path)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := readEnvFile(f, path)
+	if nil != err {
+		return nil, err
+	}
+
+	/* Pick out the ones for our flags */
+	cf.envLock.Lock()
+	prefix := cf.envPrefix
+	cf.envLock.Unlock()
+	var args []Arg
+	cf.fs.VisitAll(func(fl *flag.Flag) {
+		if v, ok := vars[envVarName(prefix, fl.Name)]; ok {
+			v.Key = fl.Name
+			args = append(args, v)
+		}
+	})
+	sort.Slice(args, func(i, j int) bool {
+		return args[i].LineNum < args[j].LineNum
+	})
+	return args, nil
+}
+
+// readEnvFile reads the variables in dotenv format from rd, which came from
+// the file name.  Lines are of the form KEY=value, optionally preceded by
+// export.  Values may be in single quotes, which are removed, or double
+// quotes, in which \n, \", and \\ are also unescaped.  Blank lines and
+// lines starting with # are ignored.  The returned Args are keyed by
+// variable name and have no Key.
+func readEnvFile(rd io.Reader, name string) (map[string]Arg, error) {
+	vars := make(map[string]Arg)
+	r := bufio.NewScanner(rd)
+	lineNum := 0
+	for r.Scan() {
+		lineNum++
+		line := strings.TrimSpace(r.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		i := strings.Index(line, "=")
+		if 0 >= i {
+			return nil, fmt.Errorf("expected KEY=value in line %v "+
+				"of %v", lineNum, name)
+		}
+		k := strings.TrimSpace(line[:i])
+		v := strings.TrimSpace(line[i+1:])
+		switch {
+		case 2 <= len(v) && '\'' == v[0] && '\'' == v[len(v)-1]:
+			v = v[1 : len(v)-1]
+		case 2 <= len(v) && '"' == v[0] && '"' == v[len(v)-1]:
+			v = strings.NewReplacer(`\n`, "\n", `\"`, `"`,
+				`\\`, `\`).Replace(v[1 : len(v)-1])
+		}
+		vars[k] = Arg{Value: v, FilePath: name, LineNum: lineNum,
+			kind: argLiteral}
+	}
+	if err := r.Err(); nil != err {
+		return nil, err
+	}
+	return vars, nil
+}
@@ -0,0 +1,60 @@
+package confflags
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AllowExec causes config values of the form exec:command to be replaced
+// with what command writes to stdout, less leading and trailing whitespace,
+// e.g. for short-lived credentials from a helper program.  The command is
+// split on whitespace and run without a shell.  If it takes longer than
+// timeout, it's killed and the config isn't applied.  A timeout of 0 means
+// no limit.  Since anybody who can write to the config file can then run
+// commands, exec: values are left as they are unless AllowExec is called.
+// Only values in the config are run; exec: values from the environment,
+// ApplyMap, and the like are always left as they are.
+func AllowExec(timeout time.Duration) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	resolvers["exec"] = noTTL(func(ref string) (string, error) {
+		return runForValue(ref, timeout)
+	})
+}
+
+// runForValue runs the command line ref and returns its trimmed stdout, or
+// an error if it took longer than timeout, if timeout isn't 0, or failed
+func runForValue(ref string, timeout time.Duration) (string, error) {
+	args := strings.Fields(ref)
+	if 0 == len(args) {
+		return "", fmt.Errorf("no command")
+	}
+	ctx := context.Background()
+	if 0 != timeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	/* Don't wait forever for its children to close stdout */
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if nil != ctx.Err() {
+		return "", fmt.Errorf("%v took longer than %v", args[0],
+			timeout)
+	}
+	if nil != err {
+		if msg := strings.TrimSpace(stderr.String()); "" != msg {
+			return "", fmt.Errorf("%v: %v", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
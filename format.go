@@ -0,0 +1,156 @@
+package confflags
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Format reads and writes config files in a particular syntax.
+type Format interface {
+	// Read returns the key/value pairs in rd.  name is used as the
+	// FilePath of the returned Args.
+	Read(rd io.Reader, name string) ([]Arg, error)
+	// Write writes args to w such that Read would return the same keys
+	// and values.
+	Write(w io.Writer, args []Arg) error
+}
+
+/* Registered formats, by name */
+var (
+	formats = map[string]Format{
+		"conf": confFormat{},
+		"args": argsFormat{},
+		"toml": tomlFormat{},
+		"yaml": yamlFormat{},
+		"json": jsonFormat{},
+		"hcl":  hclFormat{},
+	}
+	/* Formats used for config files, by extension */
+	formatExtensions = map[string]string{
+		".conf": "conf",
+		".toml": "toml",
+		".yaml": "yaml",
+		".yml":  "yaml",
+		".json": "json",
+		".hcl":  "hcl",
+	}
+	formatLock sync.Mutex
+)
+
+// RegisterFormat makes a Format available by name, replacing any format
+// already registered with the name.  The formats "conf", the default
+// whitespace-separated format, "args", one command-line argument per line,
+// "toml", "yaml", "json", and "hcl" are always available.
+func RegisterFormat(name string, f Format) {
+	formatLock.Lock()
+	defer formatLock.Unlock()
+	formats[name] = f
+}
+
+// LookupFormat returns the Format registered with the given name, or nil if
+// there is none.
+func LookupFormat(name string) Format {
+	formatLock.Lock()
+	defer formatLock.Unlock()
+	return formats[name]
+}
+
+// formatNameForPath returns the name of the format of the config file at
+// path, chosen by its extension, or "" if the extension isn't known
+func formatNameForPath(path string) string {
+	formatLock.Lock()
+	defer formatLock.Unlock()
+	return formatExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Formats returns the sorted names of the registered formats.
+func Formats() []string {
+	formatLock.Lock()
+	defer formatLock.Unlock()
+	names := make([]string, 0, len(formats))
+	for n := range formats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* confFormat is the default key/value format */
+type confFormat struct{}
+
+func (confFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	return ReadConfig(rd, name)
+}
+
+func (confFormat) Write(w io.Writer, args []Arg) error {
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "%s %s\n", arg.Key,
+			quoteValue(arg.Value, std.getCommentChar())); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/* argsFormat is one command-line argument (-key=value) per line */
+type argsFormat struct{}
+
+func (argsFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	r := bufio.NewScanner(rd)
+	args := []Arg{}
+	lineNum := 0
+	for r.Scan() {
+		lineNum++
+		line := strings.TrimSpace(r.Text())
+		/* Ignore blank lines and comments */
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		/* Should look like a flag */
+		if !strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("expected a flag in line %v "+
+				"of %v", lineNum, name)
+		}
+		line = strings.TrimPrefix(strings.TrimPrefix(line, "-"), "-")
+		/* A flag on its own is a boolean */
+		key, value := line, "true"
+		if i := strings.Index(line, "="); -1 != i {
+			key, value = line[:i], line[i+1:]
+		}
+		args = append(args, Arg{
+			Key:      key,
+			Value:    value,
+			FilePath: name,
+			LineNum:  lineNum,
+		})
+	}
+	if err := r.Err(); nil != err {
+		return nil, err
+	}
+	return args, nil
+}
+
+// Write writes args as -key=value lines.  As values aren't quoted, an error
+// is returned for values which start or end with whitespace or contain a
+// line break, which wouldn't be read back as they are.
+func (argsFormat) Write(w io.Writer, args []Arg) error {
+	for _, arg := range args {
+		if strings.TrimSpace(arg.Value) != arg.Value ||
+			strings.ContainsAny(arg.Value, "\r\n") {
+			return fmt.Errorf("value of %v can't be written as an "+
+				"argument", arg.Key)
+		}
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "-%s=%s\n", arg.Key,
+			arg.Value); nil != err {
+			return err
+		}
+	}
+	return nil
+}
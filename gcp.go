@@ -0,0 +1,235 @@
+package confflags
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Google Cloud is reached without its client libraries.  Access tokens come
+// from the service account key or gcloud user credentials named by
+// GOOGLE_APPLICATION_CREDENTIALS or, failing that, from the metadata server
+// of the instance or container.  The default project is GOOGLE_CLOUD_PROJECT.
+
+/* Where to find GCP's APIs */
+var (
+	gcpMetadataURL      = "http://metadata.google.internal"
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com"
+)
+
+/* The last access token, cached until shortly before it expires */
+var (
+	gcpToken       string
+	gcpTokenExpiry time.Time
+	gcpTokenLock   sync.Mutex
+)
+
+// resolveGCPSecret returns a secret version from GCP Secret Manager.  ref is
+// the version's name, e.g. projects/p/secrets/name/versions/latest,
+// optionally followed by # and a key, in which case the secret must be a
+// JSON object and the value of the key is returned.  If ref doesn't start
+// with projects/, it's taken to be a secret in GOOGLE_CLOUD_PROJECT, and if
+// there's no version, the latest is used.
+func resolveGCPSecret(ref string) (string, error) {
+	name, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); -1 != i {
+		name, key = ref[:i], ref[i+1:]
+	}
+	if !strings.HasPrefix(name, "projects/") {
+		p := os.Getenv("GOOGLE_CLOUD_PROJECT")
+		if "" == p {
+			return "", fmt.Errorf("no project in %v and "+
+				"GOOGLE_CLOUD_PROJECT not set", name)
+		}
+		name = "projects/" + p + "/secrets/" + name
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := gcpAccessToken()
+	if nil != err {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet,
+		gcpSecretManagerURL+"/v1/"+name+":access", nil)
+	if nil != err {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var res struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := gcpDo(req, &res); nil != err {
+		return "", err
+	}
+	return secretField(string(res.Payload.Data), key, name)
+}
+
+/* gcpAccessToken returns an access token, from the cache if it's fresh */
+func gcpAccessToken() (string, error) {
+	gcpTokenLock.Lock()
+	defer gcpTokenLock.Unlock()
+	if "" != gcpToken && time.Now().Add(time.Minute).Before(
+		gcpTokenExpiry) {
+		return gcpToken, nil
+	}
+
+	var (
+		res struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int64  `json:"expires_in"`
+		}
+		err error
+	)
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); "" != path {
+		err = gcpFileToken(path, &res)
+	} else {
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, gcpMetadataURL+
+			"/computeMetadata/v1/instance/service-accounts/"+
+			"default/token", nil)
+		if nil == err {
+			req.Header.Set("Metadata-Flavor", "Google")
+			err = gcpDo(req, &res)
+		}
+	}
+	if nil != err {
+		return "", fmt.Errorf("unable to get GCP access token: %v", err)
+	}
+	gcpToken = res.AccessToken
+	gcpTokenExpiry = time.Now().Add(time.Duration(res.ExpiresIn) *
+		time.Second)
+	return gcpToken, nil
+}
+
+// gcpFileToken gets an access token with the credentials in the file at
+// path, which may be a service account key or gcloud's user credentials
+func gcpFileToken(path string, res interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if nil != err {
+		return err
+	}
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(b, &creds); nil != err {
+		return fmt.Errorf("unable to decode %v: %v", path, err)
+	}
+	if "" == creds.TokenURI {
+		creds.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	form := url.Values{}
+	switch creds.Type {
+	case "service_account":
+		jwt, err := gcpJWT(creds.ClientEmail, creds.PrivateKey,
+			creds.TokenURI)
+		if nil != err {
+			return err
+		}
+		form.Set("grant_type",
+			"urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", jwt)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return fmt.Errorf("unsupported credentials type %q in %v",
+			creds.Type, path)
+	}
+	req, err := http.NewRequest(http.MethodPost, creds.TokenURI,
+		strings.NewReader(form.Encode()))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return gcpDo(req, res)
+}
+
+// gcpJWT returns a JWT signed with the service account's PEM-encoded key,
+// asking aud for a token for the cloud-platform scope
+func gcpJWT(email, key, aud string) (string, error) {
+	block, _ := pem.Decode([]byte(key))
+	if nil == block {
+		return "", fmt.Errorf("no private key for %v", email)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if nil != err {
+		if k, err = x509.ParsePKCS1PrivateKey(block.Bytes); nil != err {
+			return "", fmt.Errorf("unable to parse private key "+
+				"for %v: %v", email, err)
+		}
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key for %v is not RSA", email)
+	}
+
+	t := time.Now()
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	unsigned := enc(map[string]string{"alg": "RS256", "typ": "JWT"}) +
+		"." + enc(map[string]interface{}{
+		"iss":   email,
+		"scope": "https://www.googleapis.com/auth/cloud-platform",
+		"aud":   aud,
+		"iat":   t.Unix(),
+		"exp":   t.Add(time.Hour).Unix(),
+	})
+	h := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rk, crypto.SHA256, h[:])
+	if nil != err {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+/* gcpDo makes a request to a GCP API, decoding the response into res */
+func gcpDo(req *http.Request, res interface{}) error {
+	r, err := HTTPClient.Do(req)
+	if nil != err {
+		return err
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		return err
+	}
+	if http.StatusOK != r.StatusCode {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(b, &e)
+		return fmt.Errorf("%v %v failed: %v %v", req.Method, req.URL,
+			r.Status, e.Error.Message)
+	}
+	return json.Unmarshal(b, res)
+}
@@ -0,0 +1,61 @@
+package confflags
+
+import (
+	"context"
+	"sync"
+)
+
+/* Generation, and a channel closed and replaced every time it changes */
+type generationState struct {
+	generation        *int
+	generationChanged chan struct{}
+	generationLock    sync.Mutex
+}
+
+func (s *generationState) init() {
+	s.generation = new(int)
+	s.generationChanged = make(chan struct{})
+}
+
+/* nextGeneration increments the generation and wakes up WaitForGeneration */
+func (s *generationState) nextGeneration() {
+	s.generationLock.Lock()
+	defer s.generationLock.Unlock()
+	*s.generation++
+	close(s.generationChanged)
+	s.generationChanged = make(chan struct{})
+}
+
+// Generation returns cf's flags' generation number, which is incremented
+// every time a change to the flags is applied.  It is the same as the
+// package-level Generation for flag.CommandLine.
+func (cf *ConfFlags) Generation() int {
+	cf.generationLock.Lock()
+	defer cf.generationLock.Unlock()
+	return *cf.generation
+}
+
+// WaitForGeneration blocks until Generation is at least n, e.g. to make sure
+// a change to the config file has been applied.  If ctx is done first,
+// ctx.Err() is returned.
+func WaitForGeneration(ctx context.Context, n int) error {
+	return std.WaitForGeneration(ctx, n)
+}
+
+// WaitForGeneration blocks until cf.Generation() is at least n.  If ctx is
+// done first, ctx.Err() is returned.
+func (cf *ConfFlags) WaitForGeneration(ctx context.Context, n int) error {
+	for {
+		cf.generationLock.Lock()
+		g, c := *cf.generation, cf.generationChanged
+		cf.generationLock.Unlock()
+		if g >= n {
+			return nil
+		}
+		select {
+		case <-c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
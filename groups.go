@@ -0,0 +1,78 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SetGroup puts the named flags in the named group, for PrintGroupedDefaults.
+// It is the same as annotating each flag with Category(group).  A flag is
+// only ever in one group; putting it in a second group removes it from the
+// first.
+func SetGroup(group string, names ...string) {
+	std.SetGroup(group, names...)
+}
+
+// SetGroup puts the named flags in cf's FlagSet in the named group, for
+// cf.PrintGroupedDefaults.  See the package-level SetGroup.
+func (cf *ConfFlags) SetGroup(group string, names ...string) {
+	for _, n := range names {
+		cf.Annotate(n, Category(group))
+	}
+}
+
+// PrintGroupedDefaults is like flag.PrintDefaults, but prints the flags
+// under a heading for each group set with SetGroup or Category, in the order
+// in which the groups were first used.  Flags not in a group are printed
+// last, under the heading "Other".  Hidden flags aren't printed.
+func PrintGroupedDefaults(w io.Writer) {
+	std.PrintGroupedDefaults(w)
+}
+
+// PrintGroupedDefaults is like the package-level PrintGroupedDefaults, but
+// for the flags in cf's FlagSet.
+func (cf *ConfFlags) PrintGroupedDefaults(w io.Writer) {
+	/* Sort the flags into their groups */
+	sets := make(map[string]*flag.FlagSet)
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		if cf.isAnnotated(f.Name, hiddenKey) {
+			return
+		}
+		g := cf.annotation(f.Name, categoryKey)
+		if "" == g {
+			g = "Other"
+		}
+		fs, ok := sets[g]
+		if !ok {
+			fs = flag.NewFlagSet(g, flag.ContinueOnError)
+			fs.SetOutput(w)
+			sets[g] = fs
+		}
+		/* Keep the original default, not the current value */
+		fs.Var(f.Value, f.Name, f.Usage+cf.usageNote(f.Name))
+		fs.Lookup(f.Name).DefValue = f.DefValue
+	})
+
+	/* Print each group */
+	cf.annotationLock.Lock()
+	order := append(append([]string{}, cf.categoryOrder...), "Other")
+	cf.annotationLock.Unlock()
+	for _, g := range order {
+		fs, ok := sets[g]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\n%v:\n", g)
+		fs.PrintDefaults()
+		delete(sets, g) /* In case someone made a group named Other */
+	}
+}
+
+// GroupedUsage prints a usage message with the flags printed by
+// PrintGroupedDefaults to stderr.  It is meant to be assigned to flag.Usage.
+func GroupedUsage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	PrintGroupedDefaults(os.Stderr)
+}
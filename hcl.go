@@ -0,0 +1,427 @@
+package confflags
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// hclFormat reads and writes HCL.  Blocks and objects are flattened to
+// dot-separated flag names, with block labels as part of the name, so
+//
+//	http {
+//	  port = 8080
+//	}
+//	backend "db" {
+//	  host = "localhost"
+//	}
+//
+// sets -http.port and -backend.db.host.  Lists are joined with commas.
+// Expressions other than literal values are taken as strings.
+type hclFormat struct{}
+
+func (hclFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	b, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+	p := &hclParser{s: string(b), line: 1, name: name}
+	if err := p.parseBody("", false); nil != err {
+		return nil, err
+	}
+	return p.args, nil
+}
+
+func (hclFormat) Write(w io.Writer, args []Arg) error {
+	for _, arg := range args {
+		k := arg.Key
+		if "" == k || -1 != strings.IndexFunc(k, func(r rune) bool {
+			return r > 0x7f || !isHCLIdent(byte(r))
+		}) {
+			k = tomlQuote(k)
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", k,
+			hclQuote(arg.Value)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/* hclQuote returns s as an HCL string */
+func hclQuote(s string) string {
+	/* Template sequences are escaped by doubling */
+	s = strings.Replace(s, "${", "$${", -1)
+	s = strings.Replace(s, "%{", "%%{", -1)
+	return tomlQuote(s)
+}
+
+/* isHCLIdent reports whether c may be in an identifier */
+func isHCLIdent(c byte) bool {
+	return isTOMLBare(c) || '.' == c
+}
+
+/* hclParser holds the state of an HCL document being parsed */
+type hclParser struct {
+	s    string /* The document */
+	pos  int    /* Offset of the next byte in s */
+	line int    /* Line number of the next byte in s */
+	name string /* File name, for Args and errors */
+	args []Arg
+}
+
+/* errorf returns an error noting the current line */
+func (p *hclParser) errorf(f string, a ...interface{}) error {
+	return fmt.Errorf("%v in line %v of %v", fmt.Sprintf(f, a...), p.line,
+		p.name)
+}
+
+/* peek returns the next byte, or 0 at the end of the document */
+func (p *hclParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+/* next consumes and returns the next byte */
+func (p *hclParser) next() byte {
+	c := p.peek()
+	p.pos++
+	if '\n' == c {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips spaces, tabs, and comments, and newlines if nl is set.  A
+// # or // comment is skipped up to, but not including, its newline.
+func (p *hclParser) skipSpace(nl bool) error {
+	for p.pos < len(p.s) {
+		rest := p.s[p.pos:]
+		switch c := p.peek(); {
+		case ' ' == c || '\t' == c || '\r' == c:
+			p.next()
+		case nl && '\n' == c:
+			p.next()
+		case '#' == c || strings.HasPrefix(rest, "//"):
+			for 0 != p.peek() && '\n' != p.peek() {
+				p.next()
+			}
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if -1 == end {
+				return p.errorf("unterminated comment")
+			}
+			for i := 0; i < end+4; i++ {
+				p.next()
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseBody parses attributes and blocks, whose names are under prefix.  If
+// closing is set, the body ends with a }.
+func (p *hclParser) parseBody(prefix string, closing bool) error {
+	for {
+		if err := p.skipSpace(true); nil != err {
+			return err
+		}
+		switch p.peek() {
+		case 0:
+			if closing {
+				return p.errorf("missing }")
+			}
+			return nil
+		case '}':
+			if !closing {
+				return p.errorf("unexpected }")
+			}
+			p.next()
+			return nil
+		}
+
+		/* Attribute or block name */
+		line := p.line
+		name, err := p.parseName()
+		if nil != err {
+			return err
+		}
+		if err := p.skipSpace(false); nil != err {
+			return err
+		}
+		if c := p.peek(); '=' == c || ':' == c {
+			p.next()
+			if err := p.skipSpace(false); nil != err {
+				return err
+			}
+			if err := p.parseValue(prefix+name, line); nil != err {
+				return err
+			}
+			if err := p.endAttribute(); nil != err {
+				return err
+			}
+			continue
+		}
+
+		/* A block, with optional labels */
+		name = prefix + name + "."
+		for '{' != p.peek() {
+			l, err := p.parseName()
+			if nil != err {
+				return p.errorf("expected = or {")
+			}
+			name += l + "."
+			if err := p.skipSpace(false); nil != err {
+				return err
+			}
+		}
+		p.next()
+		if err := p.parseBody(name, true); nil != err {
+			return err
+		}
+	}
+}
+
+/* endAttribute consumes the end of an attribute */
+func (p *hclParser) endAttribute() error {
+	if err := p.skipSpace(false); nil != err {
+		return err
+	}
+	switch p.peek() {
+	case '\n', ',':
+		p.next()
+	case 0, '}':
+	default:
+		return p.errorf("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+/* parseName parses an identifier or quoted string */
+func (p *hclParser) parseName() (string, error) {
+	if '"' == p.peek() {
+		return p.parseString()
+	}
+	start := p.pos
+	for isHCLIdent(p.peek()) {
+		p.next()
+	}
+	if start == p.pos {
+		return "", p.errorf("expected a name")
+	}
+	return p.s[start:p.pos], nil
+}
+
+// parseValue parses the value for key, which started on line, into p.args.
+// Objects add an Arg for each of their attributes.
+func (p *hclParser) parseValue(key string, line int) error {
+	if '{' == p.peek() {
+		p.next()
+		return p.parseBody(key+".", true)
+	}
+	v, err := p.parseScalar()
+	if nil != err {
+		return err
+	}
+	p.args = append(p.args, Arg{
+		Key:      key,
+		Value:    v,
+		FilePath: p.name,
+		LineNum:  line,
+	})
+	return nil
+}
+
+/* parseScalar parses a value which isn't an object */
+func (p *hclParser) parseScalar() (string, error) {
+	switch {
+	case '"' == p.peek():
+		return p.parseString()
+	case '[' == p.peek():
+		return p.parseList()
+	case '{' == p.peek():
+		return "", p.errorf("objects in lists are not supported")
+	case strings.HasPrefix(p.s[p.pos:], "<<"):
+		return p.parseHeredoc()
+	}
+	/* Numbers, bools, null, and other expressions */
+	start := p.pos
+	for c := p.peek(); 0 != c && !strings.ContainsRune(" \t\r\n,]}#",
+		rune(c)) && !strings.HasPrefix(p.s[p.pos:], "//") &&
+		!strings.HasPrefix(p.s[p.pos:], "/*"); c = p.peek() {
+		p.next()
+	}
+	switch v := p.s[start:p.pos]; v {
+	case "":
+		return "", p.errorf("expected a value")
+	case "null":
+		return "", nil
+	default:
+		return v, nil
+	}
+}
+
+/* parseList parses a list, returning its elements joined by commas */
+func (p *hclParser) parseList() (string, error) {
+	p.next()
+	var vs []string
+	for {
+		if err := p.skipSpace(true); nil != err {
+			return "", err
+		}
+		if ']' == p.peek() {
+			p.next()
+			return strings.Join(vs, ","), nil
+		}
+		if '[' == p.peek() {
+			return "", p.errorf("lists in lists are not supported")
+		}
+		v, err := p.parseScalar()
+		if nil != err {
+			return "", err
+		}
+		vs = append(vs, v)
+		if err := p.skipSpace(true); nil != err {
+			return "", err
+		}
+		switch p.next() {
+		case ',':
+		case ']':
+			return strings.Join(vs, ","), nil
+		default:
+			return "", p.errorf("expected , or ] in list")
+		}
+	}
+}
+
+/* parseString parses a quoted string */
+func (p *hclParser) parseString() (string, error) {
+	p.next()
+	var b strings.Builder
+	for {
+		if '\n' == p.peek() || 0 == p.peek() {
+			return "", p.errorf("unterminated string")
+		}
+		rest := p.s[p.pos:]
+		switch c := p.next(); {
+		case '"' == c:
+			return b.String(), nil
+		case '\\' == c:
+			if err := p.parseEscape(&b); nil != err {
+				return "", err
+			}
+		case strings.HasPrefix(rest, "$${") ||
+			strings.HasPrefix(rest, "%%{"):
+			/* Escaped template sequences lose the doubled byte */
+			b.WriteByte(c)
+			p.next()
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+/* parseEscape parses the escape sequence after a \ in a string */
+func (p *hclParser) parseEscape(b *strings.Builder) error {
+	switch c := p.next(); c {
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if 'U' == c {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("short unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if nil != err {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		b.WriteRune(rune(r))
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// parseHeredoc parses a <<MARKER or <<-MARKER heredoc.  The latter has the
+// common leading whitespace of its lines removed.
+func (p *hclParser) parseHeredoc() (string, error) {
+	p.pos += 2
+	indent := '-' == p.peek()
+	if indent {
+		p.next()
+	}
+	start := p.pos
+	for isTOMLBare(p.peek()) {
+		p.next()
+	}
+	marker := p.s[start:p.pos]
+	if "" == marker {
+		return "", p.errorf("expected a heredoc marker")
+	}
+	if err := p.skipSpace(false); nil != err {
+		return "", err
+	}
+	if '\n' != p.next() {
+		return "", p.errorf("expected a newline after <<%v", marker)
+	}
+
+	/* Gather lines up to the marker */
+	var lines []string
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("missing %v", marker)
+		}
+		end := strings.IndexByte(p.s[p.pos:], '\n')
+		if -1 == end {
+			end = len(p.s) - p.pos
+		}
+		l := strings.TrimRight(p.s[p.pos:p.pos+end], "\r")
+		if marker == strings.TrimSpace(l) {
+			p.pos += len(p.s[p.pos : p.pos+end])
+			break
+		}
+		lines = append(lines, l)
+		for i := 0; i <= end && p.pos < len(p.s); i++ {
+			p.next()
+		}
+	}
+
+	/* Remove common indentation */
+	if indent {
+		min := -1
+		for _, l := range lines {
+			if "" == strings.TrimSpace(l) {
+				continue
+			}
+			n := len(l) - len(strings.TrimLeft(l, " \t"))
+			if -1 == min || n < min {
+				min = n
+			}
+		}
+		for i, l := range lines {
+			if len(l) >= min && 0 < min {
+				lines[i] = l[min:]
+			}
+		}
+	}
+	if 0 == len(lines) {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
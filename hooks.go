@@ -0,0 +1,80 @@
+package confflags
+
+import "fmt"
+
+/* Functions called around reloads, guarded by updateLock */
+type hookState struct {
+	beforeReload []func(pending map[string]string) error
+}
+
+// BeforeReload causes fn to be called whenever flags would be changed after
+// Parse, e.g. by re-reading the config or by ApplyMap, with the new values
+// of those flags, by name.  If fn returns an error, the reload is
+// cancelled: no flags are changed and the error is returned in the
+// UpdateResult's Vetoed.  This can be used to hold off changes while a
+// service is draining or being deployed.  Reloads which are cancelled are
+// tried again, e.g. at the next update interval, even if the config hasn't
+// changed.
+func BeforeReload(fn func(pending map[string]string) error) {
+	std.BeforeReload(fn)
+}
+
+// BeforeReload causes fn to be called before cf's flags are changed by a
+// reload.  See the package-level BeforeReload.
+func (cf *ConfFlags) BeforeReload(fn func(pending map[string]string) error) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.beforeReload = append(cf.beforeReload, fn)
+}
+
+/* vetoError is returned by applyArgs when a BeforeReload hook says no */
+type vetoError struct {
+	err error
+}
+
+func (e vetoError) Error() string {
+	return fmt.Sprintf("reload vetoed: %v", e.err)
+}
+
+// checkVeto calls the BeforeReload hooks with the flags which will change if
+// staged is applied, unless this is the first time the flags are set
+func (cf *ConfFlags) checkVeto(staged []stagedFlag) error {
+	if 0 == len(cf.beforeReload) || 0 == cf.Generation() {
+		return nil
+	}
+	pending := make(map[string]string)
+	for _, s := range staged {
+		if v := s.f.Value.String(); v != s.v && v != s.then {
+			pending[s.f.Name] = s.then
+		}
+	}
+	if 0 == len(pending) {
+		return nil
+	}
+	for _, fn := range cf.beforeReload {
+		if err := fn(pending); nil != err {
+			return vetoError{err}
+		}
+	}
+	return nil
+}
+
+// AfterReload causes fn to be called with the UpdateResult whenever the
+// config is re-read (or flags are otherwise changed) after Parse and flags
+// changed or there was an error, once the new values are in place and
+// before the UpdateResult is sent to the channel passed to Parse.  fn is
+// called synchronously, so derived state such as connection pools can be
+// rebuilt once for all the changed flags rather than in many OnFlagChange
+// callbacks.  Further reloads wait for fn to return, so it mustn't call
+// Reload or anything else which reloads the config.
+func AfterReload(fn func(UpdateResult)) {
+	std.AfterReload(fn)
+}
+
+// AfterReload causes fn to be called after cf's flags are changed by a
+// reload.  See the package-level AfterReload.
+func (cf *ConfFlags) AfterReload(fn func(UpdateResult)) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.updateHooks = append(cf.updateHooks, fn)
+}
@@ -0,0 +1,123 @@
+package confflags
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPClient is used to fetch config given with -config as an http or https
+// URL.  Its Timeout limits how long each fetch may take.
+var HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+/* Formats for config served with these Content-Types */
+var httpContentTypes = map[string]string{
+	"application/json":   "json",
+	"application/toml":   "toml",
+	"application/yaml":   "yaml",
+	"application/x-yaml": "yaml",
+	"text/yaml":          "yaml",
+	"application/hcl":    "hcl",
+}
+
+// httpSource is a Source which fetches config from an http or https URL.  The
+// format is chosen by the URL's extension, then by the Content-Type, and is
+// otherwise the default format.  The ETag of the last response is sent with
+// the next request, so unchanged config needn't be sent again.
+type httpSource struct {
+	fetcher
+	u    string
+	etag string
+	last []Arg
+	lock sync.Mutex
+}
+
+// ownedSource is implemented by Sources which need to know which ConfFlags
+// they're reading config for
+type ownedSource interface {
+	setOwner(cf *ConfFlags)
+}
+
+// fetcher is embedded in Sources which fetch config files, so the files are
+// read as the ConfFlags using the Source would read them, e.g. with its
+// comment character and section mappings
+type fetcher struct {
+	owner *ConfFlags /* std, if not set */
+}
+
+func (f *fetcher) setOwner(cf *ConfFlags) {
+	f.owner = cf
+}
+
+// readFetched reads the config b, fetched from name, whose format is chosen
+// by the extension of path, then by the Content-Type ct, and is otherwise
+// the default format
+func (f *fetcher) readFetched(b []byte, name, path, ct string) ([]Arg,
+	error) {
+	format := formatNameForPath(path)
+	if "" == format {
+		mt, _, _ := mime.ParseMediaType(ct)
+		format = httpContentTypes[mt]
+	}
+	if "" == format || "conf" == format {
+		cf := f.owner
+		if nil == cf {
+			cf = std
+		}
+		return cf.ReadConfig(bytes.NewReader(b), name)
+	}
+	ff := LookupFormat(format)
+	if nil == ff {
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	return ff.Read(bytes.NewReader(b), name)
+}
+
+/* openHTTPSource returns a Source for the http or https URL u */
+func openHTTPSource(u *url.URL) (Source, error) {
+	return &httpSource{u: u.String()}, nil
+}
+
+func (s *httpSource) Read() ([]Arg, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	/* Ask for the config, unless we already have it */
+	req, err := http.NewRequest(http.MethodGet, s.u, nil)
+	if nil != err {
+		return nil, err
+	}
+	if "" != s.etag {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	res, err := HTTPClient.Do(req)
+	if nil != err {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if http.StatusNotModified == res.StatusCode && "" != s.etag {
+		return s.last, nil
+	}
+	if http.StatusOK != res.StatusCode {
+		return nil, fmt.Errorf("unexpected status %q from %v",
+			res.Status, s.u)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		return nil, err
+	}
+
+	args, err := s.readFetched(b, s.u, req.URL.Path,
+		res.Header.Get("Content-Type"))
+	if nil != err {
+		return nil, err
+	}
+	s.etag = res.Header.Get("ETag")
+	s.last = args
+	return args, nil
+}
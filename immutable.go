@@ -0,0 +1,48 @@
+package confflags
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Flags annotated with Immutable whose changes were ignored by the last
+// update.  It's guarded by updateLock.
+type immutableState struct {
+	ignored []string
+}
+
+// dropImmutable returns staged without the changes to flags annotated with
+// Immutable, which are ignored once the flags have been parsed, along with
+// the sorted names of the ignored flags and warnings about the ignored
+// config lines
+func (cf *ConfFlags) dropImmutable(staged []stagedFlag) ([]stagedFlag,
+	[]string, []Warning) {
+	if 0 == cf.Generation() {
+		return staged, nil, nil
+	}
+	var (
+		kept    []stagedFlag
+		ignored []string
+		ws      []Warning
+	)
+	for _, s := range staged {
+		if !cf.isAnnotated(s.f.Name, immutableKey) {
+			kept = append(kept, s)
+			continue
+		}
+		/* It's fine if it's not changing */
+		cur := s.f.Value.String()
+		if v, err := s.value(); cur == s.v ||
+			(nil == err && cur == v) {
+			kept = append(kept, s)
+			continue
+		}
+		ignored = append(ignored, s.f.Name)
+		if nil != s.arg {
+			ws = append(ws, Warning{*s.arg, fmt.Sprintf(
+				"%v may only be set at startup", s.f.Name)})
+		}
+	}
+	sort.Strings(ignored)
+	return kept, ignored, ws
+}
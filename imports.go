@@ -0,0 +1,110 @@
+package confflags
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* isDirective reports whether line is the directive d, e.g. #import */
+func isDirective(line, d string) bool {
+	return strings.HasPrefix(line, d) && len(line) > len(d) &&
+		(' ' == line[len(d)] || '\t' == line[len(d)])
+}
+
+/* isImport reports whether line is an import directive */
+func isImport(line string) bool {
+	for _, d := range []string{"#import", "#import?", "#include",
+		"#include?"} {
+		if isDirective(line, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// importConfig handles a line of the form
+//
+//	#import path [as prefix]
+//
+// in line lineNum of the file name, which was itself imported by the files in
+// importStack.  #include is a synonym for #import.  If a ? is appended to the
+// directive (e.g. #include? path), a missing file is silently skipped.
+// Relative paths are relative to the directory containing name.  A path may
+// be a pattern as understood by filepath.Glob, in which case every matching
+// file is imported, in lexical order, and none need match.  If a prefix
+// is given, prefix and a . are prepended to all of the keys in the imported
+// file.  The returned Args' IncludedFrom notes the import, so errors about
+// them show how the file came to be read.  Config fetched from a Source, such
+// as an http URL, may not import files, as its paths aren't local and it
+// shouldn't be able to read local files.
+func (cf *ConfFlags) importConfig(line, name string, lineNum int,
+	importStack []string, deps *configDeps) ([]Arg, error) {
+	/* Work out the file and prefix */
+	fields := splitRE.Split(line, -1)
+	directive, fields := fields[0], fields[1:]
+	if isSourceURL(name) {
+		return nil, fmt.Errorf("%v not allowed in line %v of %v, "+
+			"which isn't a local file", directive, lineNum, name)
+	}
+	if 1 != len(fields) && (3 != len(fields) || "as" != fields[1] ||
+		"" == fields[2]) {
+		return nil, fmt.Errorf("invalid import in line %v of %v, "+
+			"expected \"%v path [as prefix]\"", lineNum, name,
+			directive)
+	}
+	path := strings.Trim(fields[0], `"`)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(name), path)
+	}
+
+	/* A pattern imports every file it matches, in order */
+	paths := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		var err error
+		if paths, err = filepath.Glob(path); nil != err {
+			return nil, fmt.Errorf("invalid pattern %v in line %v "+
+				"of %v: %v", path, lineNum, name, err)
+		}
+		deps.addGlob(path, paths)
+	}
+
+	/* Read the imported files */
+	importStack = append(importStack, filepath.Clean(name))
+	var args []Arg
+	for _, path := range paths {
+		/* Don't go round in circles */
+		for _, s := range importStack {
+			if s == path {
+				return nil, fmt.Errorf("import cycle in line "+
+					"%v of %v: %v", lineNum, name,
+					strings.Join(append(importStack, path),
+						" -> "))
+			}
+		}
+		as, err := cf.readConfigFile(path, importStack, deps)
+		if os.IsNotExist(err) && strings.HasSuffix(directive, "?") {
+			continue
+		}
+		if nil != err {
+			return nil, fmt.Errorf("unable to import %v in line "+
+				"%v of %v: %v", path, lineNum, name, err)
+		}
+		args = append(args, as...)
+	}
+
+	/* Note where the args came from, for error messages */
+	from := fmt.Sprintf("line %v of %v", lineNum, name)
+	for i := range args {
+		if 3 == len(fields) {
+			args[i].Key = fields[2] + "." + args[i].Key
+		}
+		if "" == args[i].IncludedFrom {
+			args[i].IncludedFrom = from
+		} else {
+			args[i].IncludedFrom += ", included from " + from
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,158 @@
+package confflags
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// resolveStaged works out the final values of the staged flags, and returns
+// how long the soonest-expiring value is good for, or 0 if none expire.  In
+// values from the config, ${name} is replaced with the final value of the
+// flag called name, which is its staged value, itself resolved, or its
+// current value if it's not staged, e.g. because it was set on the command
+// line.  If there's no such flag, the environment variable called name is
+// used instead, as for the placeholders written by -dumpflags.  $${ is a
+// literal ${.  The result is then read from a file or resolved with a
+// Resolver if it's an @path or a reference.  Values from files in the
+// secrets and credentials directories are read but not interpolated, and
+// other values from outside the config, such as those from the environment,
+// are used as they are, as are staged defaults.  An error is returned for
+// names which are neither flags nor environment variables, for references
+// which lead back to themselves, and for values which can't be resolved.
+func (cf *ConfFlags) resolveStaged(staged []stagedFlag) (time.Duration,
+	error) {
+	byName := make(map[string]int)
+	for i, s := range staged {
+		byName[s.f.Name] = i
+	}
+	var ttl time.Duration
+	/* resolve returns the final value of a, looking up references to
+	other flags with lookup */
+	resolve := func(a Arg, lookup func(name string) (string,
+		error)) (string, error) {
+		switch a.kind {
+		case argLiteral:
+			return a.Value, nil
+		case argConfig:
+			v, err := expandRefs(a.Value, lookup)
+			if nil != err {
+				return "", err
+			}
+			a.Value = v
+		}
+		v, vttl, err := cf.resolveArg(a)
+		if nil != err {
+			return "", err
+		}
+		if 0 != vttl && (0 == ttl || vttl < ttl) {
+			ttl = vttl
+		}
+		return v, nil
+	}
+	final := make(map[string]string)
+	expanding := make(map[string]bool)
+	var expand func(name string, path []string) (string, error)
+	expand = func(name string, path []string) (string, error) {
+		if v, ok := final[name]; ok {
+			return v, nil
+		}
+		i, ok := byName[name]
+		if !ok {
+			f := cf.fs.Lookup(name)
+			if nil != f {
+				return f.Value.String(), nil
+			}
+			/* Placeholders in dumps name environment variables */
+			if v, ok := os.LookupEnv(name); ok {
+				return v, nil
+			}
+			return "", fmt.Errorf("unknown flag or environment "+
+				"variable %v", name)
+		}
+		path = append(path, name)
+		if expanding[name] {
+			return "", fmt.Errorf("reference cycle %v",
+				strings.Join(path, " -> "))
+		}
+		if nil == staged[i].arg {
+			final[name] = staged[i].v
+			return staged[i].v, nil
+		}
+		expanding[name] = true
+		v, err := resolve(*staged[i].arg, func(ref string) (string,
+			error) {
+			return expand(ref, path)
+		})
+		expanding[name] = false
+		if nil != err {
+			return "", err
+		}
+		final[name] = v
+		return v, nil
+	}
+	for i, s := range staged {
+		v, err := expand(s.f.Name, nil)
+		if nil != err {
+			return 0, fmt.Errorf("unable to set %v: %v", s.desc, err)
+		}
+		staged[i].v = v
+
+		/* So may the other lines of a list */
+		if nil == s.lines {
+			continue
+		}
+		vs := make([]string, len(s.lines))
+		for j, la := range s.lines[:len(s.lines)-1] {
+			vs[j], err = resolve(la, func(ref string) (string,
+				error) {
+				if ref == s.f.Name {
+					return "", fmt.Errorf("reference cycle "+
+						"%v -> %v", ref, ref)
+				}
+				return expand(ref, []string{s.f.Name})
+			})
+			if nil != err {
+				return 0, fmt.Errorf("unable to set %v: %v",
+					s.desc, err)
+			}
+		}
+		vs[len(vs)-1] = v
+		staged[i].vs = vs
+	}
+	return ttl, nil
+}
+
+// expandRefs returns s with each ${name} replaced with what lookup returns
+// for name, and each $${ replaced with ${
+func expandRefs(s string, lookup func(name string) (string,
+	error)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if -1 == i {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		/* $${ is an escaped ${ */
+		if 0 < i && '$' == s[i-1] {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		j := strings.Index(s[i:], "}")
+		if -1 == j {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		v, err := lookup(s[i+2 : i+j])
+		if nil != err {
+			return "", err
+		}
+		b.WriteString(s[:i] + v)
+		s = s[i+j+1:]
+	}
+}
@@ -0,0 +1,167 @@
+package confflags
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// jsonFormat reads and writes JSON.  The config file is a single object,
+// nested objects in which are flattened to dot-separated flag names, so
+//
+//	{"http": {"port": 8080}}
+//
+// sets -http.port.  Arrays are joined with commas, and nulls are empty.
+type jsonFormat struct{}
+
+func (jsonFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	b, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+	r := &jsonReader{d: json.NewDecoder(bytes.NewReader(b)), b: b,
+		name: name}
+	r.d.UseNumber()
+	if err := r.read(); nil != err {
+		return nil, fmt.Errorf("%v in line %v of %v", err, r.line(),
+			name)
+	}
+	return r.args, nil
+}
+
+func (jsonFormat) Write(w io.Writer, args []Arg) error {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, arg := range args {
+		k, err := json.Marshal(arg.Key)
+		if nil != err {
+			return err
+		}
+		v, err := json.Marshal(arg.Value)
+		if nil != err {
+			return err
+		}
+		if 0 != i {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "\n\t%s: %s", k, v)
+	}
+	if 0 != len(args) {
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+/* jsonReader holds the state of a JSON document being read */
+type jsonReader struct {
+	d    *json.Decoder
+	b    []byte /* The document */
+	name string /* File name, for Args */
+	args []Arg
+}
+
+/* line returns the line number of the decoder's position */
+func (r *jsonReader) line() int {
+	return 1 + bytes.Count(r.b[:r.d.InputOffset()], []byte("\n"))
+}
+
+/* read reads the document, which must be a single object, into r.args */
+func (r *jsonReader) read() error {
+	t, err := r.d.Token()
+	if nil != err {
+		return err
+	}
+	if json.Delim('{') != t {
+		return fmt.Errorf("expected an object")
+	}
+	if err := r.readObject(""); nil != err {
+		return err
+	}
+	if _, err := r.d.Token(); io.EOF != err {
+		return fmt.Errorf("unexpected data after object")
+	}
+	return nil
+}
+
+/* readObject reads the members of an object whose keys are under prefix */
+func (r *jsonReader) readObject(prefix string) error {
+	for r.d.More() {
+		t, err := r.d.Token()
+		if nil != err {
+			return err
+		}
+		if err := r.readValue(prefix+t.(string), r.line()); nil !=
+			err {
+			return err
+		}
+	}
+	/* The closing } */
+	_, err := r.d.Token()
+	return err
+}
+
+/* readValue reads the value for key, which is in line */
+func (r *jsonReader) readValue(key string, line int) error {
+	t, err := r.d.Token()
+	if nil != err {
+		return err
+	}
+	var v string
+	switch t {
+	case json.Delim('{'):
+		return r.readObject(key + ".")
+	case json.Delim('['):
+		if v, err = r.readArray(); nil != err {
+			return err
+		}
+	default:
+		v = jsonScalar(t)
+	}
+	r.args = append(r.args, Arg{
+		Key:      key,
+		Value:    v,
+		FilePath: r.name,
+		LineNum:  line,
+	})
+	return nil
+}
+
+/* readArray reads an array, returning its elements joined by commas */
+func (r *jsonReader) readArray() (string, error) {
+	var b bytes.Buffer
+	for r.d.More() {
+		t, err := r.d.Token()
+		if nil != err {
+			return "", err
+		}
+		if _, ok := t.(json.Delim); ok {
+			return "", fmt.Errorf("arrays and objects in arrays " +
+				"are not supported")
+		}
+		if 0 != b.Len() {
+			b.WriteByte(',')
+		}
+		b.WriteString(jsonScalar(t))
+	}
+	/* The closing ] */
+	_, err := r.d.Token()
+	return b.String(), err
+}
+
+/* jsonScalar returns the value of a string, number, bool, or null token */
+func jsonScalar(t json.Token) string {
+	switch t := t.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	return "" /* null */
+}
@@ -0,0 +1,188 @@
+package confflags
+
+import (
+	"flag"
+	"strings"
+	"sync"
+)
+
+// configValue is the value of -config, which may be given more than once or
+// as a comma-separated list, with later files overriding earlier ones.  A
+// comma in a path is escaped with a backslash.
+type configValue []string
+
+func (v *configValue) String() string {
+	ps := make([]string, len(*v))
+	for i, p := range *v {
+		ps[i] = strings.Replace(p, ",", `\,`, -1)
+	}
+	return strings.Join(ps, ",")
+}
+
+func (v *configValue) Set(s string) error {
+	for _, p := range splitPaths(s) {
+		if "" != p {
+			*v = append(*v, p)
+		}
+	}
+	return nil
+}
+
+// lockedConfigValue is the flag.Value for -config, which holds lock while
+// using v, as SetConfigPath may change v while the config is being read
+type lockedConfigValue struct {
+	v    *configValue
+	lock *sync.Mutex
+}
+
+func (l *lockedConfigValue) String() string {
+	/* The flag package makes zero values to find out the default */
+	if nil == l.v {
+		return ""
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.v.String()
+}
+
+func (l *lockedConfigValue) Set(s string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.v.Set(s)
+}
+
+func (l *lockedConfigValue) Reset() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.v.Reset()
+}
+
+// splitPaths splits s on commas not preceded by a backslash, and unescapes
+// the escaped ones.  Other backslashes are left alone, for Windows paths.
+func splitPaths(s string) []string {
+	var (
+		ps  []string
+		cur strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case '\\' == s[i] && i+1 < len(s) && ',' == s[i+1]:
+			cur.WriteByte(',')
+			i++
+		case ',' == s[i]:
+			ps = append(ps, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(ps, cur.String())
+}
+
+func (v *configValue) Reset() {
+	*v = nil
+}
+
+/* paths returns a copy of the config file paths */
+func (v *configValue) paths() []string {
+	return append([]string(nil), *v...)
+}
+
+// getArgsFromConfigs reads the config files and Sources in paths, with each
+// overriding the ones before it.  A line is dropped if a later file sets the
+// same key in the same namespace.  The files read are noted in deps if it's
+// not nil.
+func (cf *ConfFlags) getArgsFromConfigs(paths []string,
+	deps *configDeps) ([]Arg, error) {
+	layers := make([][]Arg, len(paths))
+	for i, path := range paths {
+		args, err := cf.getArgsFromConfig(path, deps)
+		if nil != err {
+			return nil, err
+		}
+		layers[i] = args
+	}
+	return layerArgs(layers), nil
+}
+
+// layerArgs merges layers of Args, dropping those whose key and namespace
+// are set by a later layer.  Repeats within a layer are left alone.
+func layerArgs(layers [][]Arg) []Arg {
+	type key struct{ key, ns string }
+	later := make(map[key]bool)
+	kept := make([][]Arg, len(layers))
+	for i := len(layers) - 1; 0 <= i; i-- {
+		var mine []key
+		for _, arg := range layers[i] {
+			k := key{arg.Key, arg.Namespace}
+			if later[k] {
+				continue
+			}
+			kept[i] = append(kept[i], arg)
+			mine = append(mine, k)
+		}
+		for _, k := range mine {
+			later[k] = true
+		}
+	}
+	var args []Arg
+	for _, l := range kept {
+		args = append(args, l...)
+	}
+	return args
+}
+
+/* Where each flag set other than on the command line got its value */
+type originState struct {
+	origins    map[string]string
+	originLock sync.Mutex
+}
+
+func (s *originState) init() {
+	s.origins = make(map[string]string)
+}
+
+// setOrigins records where the flags named in set got their values, and that
+// the flags named in reset have their defaults
+func (s *originState) setOrigins(set map[string]string, reset []string) {
+	s.originLock.Lock()
+	defer s.originLock.Unlock()
+	for name, o := range set {
+		s.origins[name] = o
+	}
+	for _, name := range reset {
+		delete(s.origins, name)
+	}
+}
+
+// FlagSource returns where the named flag in flag.CommandLine got its
+// current value: "command line", the location in a config file, e.g.
+// "line 3 of prod.conf", the environment variable, e.g. "$MYAPP_HTTP_PORT",
+// or "default".  With more than one -config, this tells which file won.
+// It returns "" if there is no such flag.
+func FlagSource(name string) string {
+	return std.FlagSource(name)
+}
+
+// FlagSource returns where the named flag in cf's FlagSet got its current
+// value.  See the package-level FlagSource.
+func (cf *ConfFlags) FlagSource(name string) string {
+	if nil == cf.fs.Lookup(name) {
+		return ""
+	}
+	onCL := false
+	cf.fs.Visit(func(f *flag.Flag) {
+		if name == f.Name {
+			onCL = true
+		}
+	})
+	if onCL {
+		return "command line"
+	}
+	cf.originLock.Lock()
+	defer cf.originLock.Unlock()
+	if o, ok := cf.origins[name]; ok {
+		return o
+	}
+	return "default"
+}
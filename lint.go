@@ -0,0 +1,163 @@
+package confflags
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+/* Comments in -dumpflags output describing flags for ReadSchema */
+const (
+	hiddenMarker     = "# Hidden: "     /* Not otherwise dumped */
+	deprecatedMarker = "# Deprecated: " /* Alias for another flag */
+	listMarker       = "# List: "       /* May be set more than once */
+)
+
+// LintError describes a problem found by Lint with a line in a config file.
+type LintError struct {
+	Arg        /* The offending line */
+	Msg string /* What's wrong with it */
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.FilePath, e.LineNum, e.Msg)
+}
+
+// ReadSchema reads a schema for Lint from rd, normally a program's -dumpflags
+// output.  It's read like a config file with ReadConfig, but the names of
+// hidden and deprecated flags, which the dump notes in comments, are returned
+// as well, and the names of list flags, which may be set more than once, are
+// returned twice.  name is used as the FilePath of the returned Args.
+func ReadSchema(rd io.Reader, name string) ([]Arg, error) {
+	b, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+	schema, err := ReadConfig(bytes.NewReader(b), name)
+	if nil != err {
+		return nil, err
+	}
+	lists := make(map[string]bool)
+	var aliases []Arg /* Deprecated flags, with their replacements */
+	for i, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimRight(l, "\r")
+		var fs []string
+		switch {
+		case strings.HasPrefix(l, hiddenMarker):
+			fs = strings.Fields(l[len(hiddenMarker):])
+		case strings.HasPrefix(l, deprecatedMarker):
+			fs = strings.Fields(l[len(deprecatedMarker):])
+			if 0 != len(fs) {
+				aliases = append(aliases, Arg{
+					Key:   fs[0],
+					Value: fs[len(fs)-1],
+				})
+			}
+		case strings.HasPrefix(l, listMarker):
+			fs = strings.Fields(l[len(listMarker):])
+			if 0 != len(fs) {
+				lists[fs[0]] = true
+			}
+		}
+		if 0 == len(fs) {
+			continue
+		}
+		schema = append(schema, Arg{
+			Key:      fs[0],
+			FilePath: name,
+			LineNum:  i + 1,
+		})
+	}
+
+	/* Deprecated names of list flags are lists as well */
+	for _, a := range aliases {
+		if lists[a.Value] && !lists[a.Key] {
+			lists[a.Key] = true
+			schema = append(schema, Arg{Key: a.Key, FilePath: name})
+		}
+	}
+	return schema, nil
+}
+
+// Lint checks the key/value pairs in args, as returned by ReadConfig, against
+// a schema of known flags, which is normally a program's -dumpflags output
+// read with ReadSchema.  A *LintError is returned for every key not in the
+// schema and every key which is set more than once, other than keys which are
+// in the schema more than once, as ReadSchema returns list flags, for which
+// repeating a key adds to the list.
+func Lint(args []Arg, schema []Arg) []error {
+	return std.Lint(args, schema)
+}
+
+// Lint checks args against schema.  See the package-level Lint.
+func (cf *ConfFlags) Lint(args []Arg, schema []Arg) []error {
+	/* Flags which may be set, and those which may be set more than
+	once */
+	known := make(map[string]bool)
+	lists := make(map[string]bool)
+	for _, s := range schema {
+		if known[s.Key] {
+			lists[s.Key] = true
+		}
+		known[s.Key] = true
+	}
+
+	var errs []error
+	seen := make(map[string]Arg)
+	for _, arg := range args {
+		/* Make sure the key is actually a flag */
+		if !known[arg.Key] {
+			msg := fmt.Sprintf("unknown flag %q", arg.Key)
+			if s := closestName(arg.Key, known); "" != s {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			errs = append(errs, &LintError{arg, msg})
+			continue
+		}
+		/* Only the last of several lines takes effect, unless
+		they're added to a list */
+		if prev, ok := seen[arg.Key]; ok && !lists[arg.Key] {
+			errs = append(errs, &LintError{arg, fmt.Sprintf(
+				"%q already set in line %v of %v", arg.Key,
+				prev.LineNum, prev.FilePath)})
+		}
+		seen[arg.Key] = arg
+	}
+	return errs
+}
+
+// closestName returns the name in names within two edits of name, or "" if
+// there isn't one
+func closestName(name string, names map[string]bool) string {
+	best, bestDist := "", 3
+	for n := range names {
+		if d := editDistance(name, n); d < bestDist ||
+			(d == bestDist && n < best) {
+			best, bestDist = n, d
+		}
+	}
+	return best
+}
+
+/* editDistance returns the Levenshtein distance between a and b */
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,67 @@
+package confflags
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/* heredocRE matches a value which starts a heredoc, e.g. <<EOF */
+var heredocRE = regexp.MustCompile(`^<<([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// continueLine returns line, less any comment starting with c, joined with
+// the lines read from r which continue it, i.e. which follow lines ending in
+// whitespace and a backslash once comments are removed, and how many lines
+// were read.  The backslashes, the whitespace before them, and the leading
+// whitespace of the continuing lines are removed.  A backslash right after
+// something else, as in C:\dir\, or right after the key, as in a line which
+// is just key \, doesn't continue the line, and a final \\ after whitespace
+// is a literal backslash.  Lines starting with # are returned as they are.
+func continueLine(r *bufio.Scanner, line string, c rune) (string, int) {
+	if strings.HasPrefix(line, "#") {
+		return line, 0
+	}
+	n := 0
+	line = stripComment(line, c)
+	for continues(line) && r.Scan() {
+		n++
+		line = stripComment(strings.TrimRightFunc(line[:len(line)-1],
+			unicode.IsSpace)+strings.TrimSpace(r.Text()), c)
+	}
+	/* A final \\ is an escaped \ */
+	if strings.HasSuffix(line, `\\`) && 3 <= len(line) &&
+		unicode.IsSpace(rune(line[len(line)-3])) {
+		line = line[:len(line)-1]
+	}
+	return line, n
+}
+
+// continues reports whether line ends in whitespace and a backslash which
+// follow a value, and not just a key
+func continues(line string) bool {
+	if !strings.HasSuffix(line, `\`) || 2 > len(line) ||
+		!unicode.IsSpace(rune(line[len(line)-2])) {
+		return false
+	}
+	rest := strings.TrimRightFunc(line[:len(line)-1], unicode.IsSpace)
+	return -1 != strings.IndexFunc(rest, unicode.IsSpace) ||
+		strings.Contains(rest, "=")
+}
+
+// readHeredoc returns the lines read from r up to one consisting of end,
+// which may be surrounded by whitespace, joined with newlines, and how many
+// lines were read, including the one with end.  The lines are taken as they
+// are, without removing whitespace or comments.  If r runs out of lines
+// first, ok is false.
+func readHeredoc(r *bufio.Scanner, end string) (v string, n int, ok bool) {
+	var lines []string
+	for r.Scan() {
+		n++
+		if end == strings.TrimSpace(r.Text()) {
+			return strings.Join(lines, "\n"), n, true
+		}
+		lines = append(lines, r.Text())
+	}
+	return "", n, false
+}
@@ -0,0 +1,74 @@
+package confflags
+
+import (
+	"strings"
+	"sync"
+)
+
+/* Sections for namespaces start with this */
+const namespaceSectionPrefix = "tenant:"
+
+/* The current namespace */
+type namespaceState struct {
+	namespace     string
+	namespaceLock sync.Mutex
+}
+
+// SetNamespace selects the namespace whose [tenant:namespace] sections of
+// the config file are used, and re-reads the config file.  Keys in such a
+// section are flag names, as outside of sections, and override values set
+// elsewhere in the file.  Sections for other namespaces are ignored.  An
+// empty namespace selects no namespace.
+func SetNamespace(ns string) UpdateResult {
+	return std.SetNamespace(ns)
+}
+
+// SetNamespace selects the namespace whose [tenant:namespace] sections of
+// cf's config file are used, and re-reads the config file.  See the
+// package-level SetNamespace.
+func (cf *ConfFlags) SetNamespace(ns string) UpdateResult {
+	cf.updateLock.Lock()
+	cf.namespaceLock.Lock()
+	cf.namespace = ns
+	cf.namespaceLock.Unlock()
+	cf.lastDeps = nil
+	cf.updateLock.Unlock()
+	return cf.updateConfig()
+}
+
+// Namespace returns the namespace set with SetNamespace.
+func Namespace() string {
+	return std.Namespace()
+}
+
+// Namespace returns the namespace set with cf.SetNamespace.
+func (cf *ConfFlags) Namespace() string {
+	cf.namespaceLock.Lock()
+	defer cf.namespaceLock.Unlock()
+	return cf.namespace
+}
+
+// sectionNamespace returns the namespace for a [tenant:namespace] section,
+// or "" if the section isn't one
+func sectionNamespace(section string) string {
+	if !strings.HasPrefix(section, namespaceSectionPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(section[len(namespaceSectionPrefix):])
+}
+
+// selectNamespace returns the Args in args not in a namespace followed by
+// those in the current namespace.
+func (cf *ConfFlags) selectNamespace(args []Arg) []Arg {
+	ns := cf.Namespace()
+	var base, selected []Arg
+	for _, arg := range args {
+		switch arg.Namespace {
+		case "":
+			base = append(base, arg)
+		case ns:
+			selected = append(selected, arg)
+		}
+	}
+	return append(base, selected...)
+}
@@ -0,0 +1,185 @@
+package confflags
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Where to find GCS's API */
+var gcsURL = "https://storage.googleapis.com"
+
+// s3Source is a Source which reads config from an object in Amazon S3, e.g.
+// s3://bucket/app.conf, in the default region or the one given with
+// ?region=.  The object is only downloaded again if its ETag changes.  The
+// format is chosen as for http URLs.  Credentials are found as described in
+// aws.go; AWS_ENDPOINT_URL_S3 gives a path-style endpoint.
+type s3Source struct {
+	fetcher
+	name   string
+	bucket string
+	key    string
+	region string /* "" for the default */
+	etag   string
+	last   []Arg
+	lock   sync.Mutex
+}
+
+/* openS3Source returns a Source for the s3 URL u */
+func openS3Source(u *url.URL) (Source, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if "" == u.Host || "" == key {
+		return nil, fmt.Errorf("expected s3://bucket/key")
+	}
+	return &s3Source{
+		name:   "s3://" + u.Host + "/" + key,
+		bucket: u.Host,
+		key:    key,
+		region: u.Query().Get("region"),
+	}, nil
+}
+
+func (s *s3Source) Read() ([]Arg, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	region := s.region
+	if "" == region {
+		var err error
+		if region, err = awsRegion(); nil != err {
+			return nil, err
+		}
+	}
+	creds, err := awsCredentials()
+	if nil != err {
+		return nil, err
+	}
+
+	/* Virtual-hosted style, unless there's another endpoint */
+	path := "/" + awsEscapePath(s.key)
+	u := awsEndpoint("s3", region) + s.bucket + path
+	if u == fmt.Sprintf("https://s3.%v.amazonaws.com/%v%v", region,
+		s.bucket, path) {
+		u = fmt.Sprintf("https://%v.s3.%v.amazonaws.com%v", s.bucket,
+			region, path)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if nil != err {
+		return nil, err
+	}
+	if "" != s.etag {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	awsSign(req, nil, creds, "s3", region, time.Now())
+
+	res, err := HTTPClient.Do(req)
+	if nil != err {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if http.StatusNotModified == res.StatusCode && "" != s.etag {
+		return s.last, nil
+	}
+	if http.StatusOK != res.StatusCode {
+		return nil, fmt.Errorf("unexpected status %q from %v",
+			res.Status, s.name)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		return nil, err
+	}
+	args, err := s.readFetched(b, s.name, s.key,
+		res.Header.Get("Content-Type"))
+	if nil != err {
+		return nil, err
+	}
+	s.etag = res.Header.Get("ETag")
+	s.last = args
+	return args, nil
+}
+
+// gcsSource is a Source which reads config from an object in Google Cloud
+// Storage, e.g. gs://bucket/app.conf.  The object is only downloaded again
+// if its generation changes.  The format is chosen as for http URLs.
+// Credentials are found as described in gcp.go.
+type gcsSource struct {
+	fetcher
+	name       string
+	bucket     string
+	key        string
+	generation string
+	last       []Arg
+	lock       sync.Mutex
+}
+
+/* openGCSSource returns a Source for the gs URL u */
+func openGCSSource(u *url.URL) (Source, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if "" == u.Host || "" == key {
+		return nil, fmt.Errorf("expected gs://bucket/key")
+	}
+	return &gcsSource{
+		name:   "gs://" + u.Host + "/" + key,
+		bucket: u.Host,
+		key:    key,
+	}, nil
+}
+
+func (s *gcsSource) Read() ([]Arg, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token, err := gcpAccessToken()
+	if nil != err {
+		return nil, err
+	}
+	obj := fmt.Sprintf("%v/storage/v1/b/%v/o/%v", gcsURL,
+		url.PathEscape(s.bucket), url.PathEscape(s.key))
+
+	/* Don't download it if we already have this generation */
+	req, err := http.NewRequest(http.MethodGet, obj, nil)
+	if nil != err {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var meta struct {
+		Generation  string `json:"generation"`
+		ContentType string `json:"contentType"`
+	}
+	if err := gcpDo(req, &meta); nil != err {
+		return nil, err
+	}
+	if "" != s.generation && meta.Generation == s.generation {
+		return s.last, nil
+	}
+
+	/* Get this generation */
+	if req, err = http.NewRequest(http.MethodGet, obj+"?alt=media&"+
+		"generation="+url.QueryEscape(meta.Generation),
+		nil); nil != err {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := HTTPClient.Do(req)
+	if nil != err {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if http.StatusOK != res.StatusCode {
+		return nil, fmt.Errorf("unexpected status %q from %v",
+			res.Status, s.name)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		return nil, err
+	}
+	args, err := s.readFetched(b, s.name, s.key, meta.ContentType)
+	if nil != err {
+		return nil, err
+	}
+	s.generation = meta.Generation
+	s.last = args
+	return args, nil
+}
@@ -0,0 +1,48 @@
+package confflags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// unquoteValue returns v without its quotes, if it's quoted.  Within double
+// quotes, backslash escapes such as \n, \t, and \" are as in Go.  Within
+// single quotes, everything is taken literally.  Values which aren't quoted
+// are returned as they are, backslashes and all.
+func unquoteValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		u, err := strconv.Unquote(v)
+		if nil != err {
+			return "", fmt.Errorf("invalid quoted value %v", v)
+		}
+		return u, nil
+	case strings.HasPrefix(v, "'"):
+		if 2 > len(v) || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("unterminated quoted value %v", v)
+		}
+		return v[1 : len(v)-1], nil
+	}
+	return v, nil
+}
+
+// quoteValue returns v, double-quoted if it wouldn't otherwise be read back
+// as it is, e.g. because it's empty, starts or ends with whitespace, starts
+// with a quote or what would start a heredoc, ends with what would be a line
+// continuation, contains a newline, or contains what would be a comment
+// starting with c.  Quoting doesn't stop @path, ${name}, and scheme:
+// references from being resolved once the value is read back; escapeValue
+// does that.
+func quoteValue(v string, c rune) string {
+	if "" == v || strings.TrimSpace(v) != v || hasComment(v, c) ||
+		strings.HasPrefix(v, `"`) || strings.HasPrefix(v, "'") ||
+		strings.HasPrefix(v, "<<") || strings.HasSuffix(v, `\`) ||
+		-1 != strings.IndexFunc(v, func(r rune) bool {
+			return !unicode.IsPrint(r)
+		}) {
+		return strconv.Quote(v)
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package confflags
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StateEnv is the name of the environment variable used by Reexec to pass
+// the effective config to the new process.
+const StateEnv = "CONFFLAGS_REEXEC_STATE"
+
+// EffectiveArgs returns command-line arguments which reproduce the current
+// value of every flag which differs from its default.  Note that flags given
+// on the command line can't be changed by the config file, so a process
+// started with these arguments will not see later config file changes to
+// any of them.  Reexec avoids this.
+func EffectiveArgs() []string {
+	args := []string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if isDumpFlag(f.Name) {
+			return
+		}
+		if v := f.Value.String(); v != f.DefValue {
+			args = append(args, fmt.Sprintf("-%v=%v", f.Name, v))
+		}
+	})
+	return args
+}
+
+// Reexec starts a new instance of the running binary with the same
+// effective config as this one, for zero-downtime binary upgrades.  Flags
+// given on this process's command line are given on the new process's
+// command line.  Values which came from the config file are passed in the
+// environment variable named by StateEnv, and are used by Parse in place of
+// the first read of the config file, so runtime changes aren't lost even if
+// the file has since been modified.  Later reloads read the file as usual.
+// The values, including those of flags annotated with Secret, are in
+// plaintext in the environment variable, which may be readable by other
+// processes run by the same user (e.g. in /proc on Linux) and is inherited
+// by the new process's children unless it unsets it.
+//
+// The files in extraFiles are passed to the new process as file
+// descriptors 3 and up, as with exec.Cmd's ExtraFiles (e.g. for listening
+// sockets).  It is up to the caller to stop this process once the new one is
+// ready.
+func Reexec(extraFiles ...*os.File) (*os.Process, error) {
+	/* Find ourselves */
+	path, err := os.Executable()
+	if nil != err {
+		return nil, err
+	}
+
+	/* Command line flags stay command line flags */
+	args := []string{os.Args[0]}
+	onCL := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		if isDumpFlag(f.Name) {
+			return
+		}
+		onCL[f.Name] = true
+		args = append(args,
+			fmt.Sprintf("-%v=%v", f.Name, f.Value.String()))
+	})
+	args = append(args, "--")
+	args = append(args, flag.Args()...)
+
+	/* Everything else goes in the environment */
+	state := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if onCL[f.Name] || isDumpFlag(f.Name) {
+			return
+		}
+		if v := f.Value.String(); v != f.DefValue {
+			state[f.Name] = v
+		}
+	})
+	b, err := json.Marshal(state)
+	if nil != err {
+		return nil, err
+	}
+	env := []string{StateEnv + "=" + string(b)}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, StateEnv+"=") {
+			env = append(env, e)
+		}
+	}
+
+	/* Start the new process */
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	files = append(files, extraFiles...)
+	return os.StartProcess(path, args, &os.ProcAttr{
+		Env:   env,
+		Files: files,
+	})
+}
+
+// Get the config passed by Reexec, if there is any.  ok is false if the
+// process wasn't started by Reexec, or if cf isn't for flag.CommandLine,
+// whose flags are the only ones Reexec passes.  The environment variable is
+// removed to keep it from leaking into our own children.
+func (cf *ConfFlags) reexecStateArgs() (args []Arg, ok bool, err error) {
+	if flag.CommandLine != cf.fs {
+		return nil, false, nil
+	}
+	s, ok := os.LookupEnv(StateEnv)
+	if !ok {
+		return nil, false, nil
+	}
+	os.Unsetenv(StateEnv)
+	state := make(map[string]string)
+	if err := json.Unmarshal([]byte(s), &state); nil != err {
+		return nil, false, fmt.Errorf("unable to decode %v: %v",
+			StateEnv, err)
+	}
+	/* Sorted, for repeatable error messages */
+	keys := make([]string, 0, len(state))
+	for k := range state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, Arg{
+			Key:      k,
+			Value:    state[k],
+			FilePath: "$" + StateEnv,
+			kind:     argLiteral,
+		})
+	}
+	return args, true, nil
+}
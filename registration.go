@@ -0,0 +1,42 @@
+package confflags
+
+// Registration is a callback registered with OnFlagChange, OnFlagChange2, or
+// OnAnyFlagChange, which may be removed with Unregister, e.g. when the
+// component which registered it is torn down.
+type Registration struct {
+	cf   *ConfFlags
+	name string /* Flag name, or "" for OnAnyFlagChange */
+	reg  *callbackReg
+}
+
+// Unregister removes the callback, so it won't be called again.  A call
+// which has already started isn't stopped.  Calling Unregister more than
+// once is harmless.
+func (r *Registration) Unregister() {
+	r.cf.callbackLock.Lock()
+	defer r.cf.callbackLock.Unlock()
+	r.cf.unregister(r.name, r.reg)
+}
+
+// unregister removes reg, registered for the flag name or, if name is "",
+// with OnAnyFlagChange.  callbackLock must be held.
+func (cf *ConfFlags) unregister(name string, reg *callbackReg) {
+	regs := cf.anyChangeCallbacks
+	if "" != name {
+		regs = cf.flagChangeCallbacks[name]
+	}
+	kept := make([]*callbackReg, 0, len(regs))
+	for _, r := range regs {
+		if r != reg {
+			kept = append(kept, r)
+		}
+	}
+	switch {
+	case "" == name:
+		cf.anyChangeCallbacks = kept
+	case 0 == len(kept):
+		delete(cf.flagChangeCallbacks, name)
+	default:
+		cf.flagChangeCallbacks[name] = kept
+	}
+}
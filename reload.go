@@ -0,0 +1,24 @@
+package confflags
+
+import "errors"
+
+// Reload re-reads the config file and updates the flags, as on SIGHUP, and
+// returns the result, e.g. for an admin endpoint or a test.  The config is
+// read even if its files appear not to have changed.  The result isn't sent
+// on the channel passed to Parse.
+func Reload() UpdateResult {
+	return std.Reload()
+}
+
+// Reload re-reads cf's config file and updates the flags.  See the
+// package-level Reload.
+func (cf *ConfFlags) Reload() UpdateResult {
+	if !cf.parsed {
+		return UpdateResult{Err: errors.New("flags not yet parsed")}
+	}
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	/* Don't skip unchanged files */
+	cf.lastDeps = nil
+	return cf.finishUpdate(cf.parseConfigFlags())
+}
@@ -0,0 +1,74 @@
+package confflags
+
+import (
+	"fmt"
+	"sync"
+)
+
+/* Config keys to be read as other keys, set with RenameKeys */
+type renameState struct {
+	renames    map[string]string
+	renameLock sync.Mutex
+}
+
+// RenameKeys causes keys in the config file, or the environment, which are
+// keys in renames to set the flags named by the corresponding values, e.g.
+// to migrate a large config file to new flag names a little at a time.  Keys
+// which are neither renamed nor the names of flags are still errors, so
+// typos are still caught.  Unlike Deprecate, RenameKeys doesn't cause
+// warnings, and doesn't affect the command line.  It replaces any renames set
+// before.
+//
+// A config file may also rename keys in the lines which follow with a line
+// of the form
+//
+//	#rename old new
+func RenameKeys(renames map[string]string) {
+	std.RenameKeys(renames)
+}
+
+// RenameKeys sets the keys in cf's config which are read as other keys.  See
+// the package-level RenameKeys.
+func (cf *ConfFlags) RenameKeys(renames map[string]string) {
+	r := make(map[string]string)
+	for k, v := range renames {
+		r[k] = v
+	}
+	cf.renameLock.Lock()
+	cf.renames = r
+	cf.renameLock.Unlock()
+	/* The config should be read again with the new names */
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.lastDeps = nil
+}
+
+// renameKeys returns args with the keys renamed with RenameKeys and
+// Deprecate, and warnings about the deprecated keys
+func (cf *ConfFlags) renameKeys(args []Arg) ([]Arg, []Warning) {
+	cf.renameLock.Lock()
+	renames := cf.renames
+	cf.renameLock.Unlock()
+	if 0 != len(renames) {
+		out := make([]Arg, len(args))
+		for i, arg := range args {
+			if n, ok := renames[arg.Key]; ok {
+				arg.Key = n
+			}
+			out[i] = arg
+		}
+		args = out
+	}
+	return cf.renameDeprecated(args)
+}
+
+// parseRename parses a #rename directive in line lineNum of the file name,
+// returning the old and new keys
+func parseRename(line, name string, lineNum int) (string, string, error) {
+	fields := splitRE.Split(line, -1)
+	if 3 != len(fields) {
+		return "", "", fmt.Errorf("invalid rename in line %v of %v, "+
+			"expected \"#rename old new\"", lineNum, name)
+	}
+	return fields[1], fields[2], nil
+}
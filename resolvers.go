@@ -0,0 +1,194 @@
+package confflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver returns the value referred to by ref, the part of a config value
+// after the scheme and colon, e.g. my/secret#password for
+// awssecret:my/secret#password.
+type Resolver func(ref string) (string, error)
+
+// ttlResolver is a Resolver which also returns how long the value is good
+// for, or 0 if it doesn't expire
+type ttlResolver func(ref string) (string, time.Duration, error)
+
+/* Resolvers, by scheme */
+var (
+	resolvers = map[string]ttlResolver{
+		"awssecret": noTTL(resolveAWSSecret),
+		"vault":     resolveVault,
+		"gcpsecret": noTTL(resolveGCPSecret),
+	}
+	resolverLock sync.Mutex
+)
+
+/* noTTL makes r a ttlResolver whose values don't expire */
+func noTTL(r Resolver) ttlResolver {
+	return func(ref string) (string, time.Duration, error) {
+		v, err := r(ref)
+		return v, 0, err
+	}
+}
+
+// RegisterResolver causes config values starting with scheme and a colon to
+// be replaced with what r returns for the rest of the value, e.g. to fetch
+// secrets so they needn't be in the config file.  Values are resolved
+// whenever the config is read, but only for flags not set on the command
+// line.  If r returns an error, the config isn't applied.  The schemes
+// "awssecret", "vault", and "gcpsecret" are always available; see the
+// README.  A value with the colon doubled, e.g. vault::x, is used as it is,
+// with one colon.
+func RegisterResolver(scheme string, r Resolver) {
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	resolvers[scheme] = noTTL(r)
+}
+
+// resolveValue returns v, or what it refers to if it starts with a
+// registered scheme, and how long that's good for, or 0 if it doesn't
+// expire.  A scheme followed by two colons is an escaped scheme and one
+// colon, e.g. vault::x for a literal vault:x.
+func resolveValue(v string) (string, time.Duration, error) {
+	r, ok := resolverFor(v)
+	if !ok {
+		return v, 0, nil
+	}
+	i := strings.Index(v, ":")
+	if strings.HasPrefix(v[i+1:], ":") {
+		return v[:i] + v[i+1:], 0, nil
+	}
+	return r(v[i+1:])
+}
+
+// resolveArg returns a's value, or what it refers to if it names a file or
+// starts with a registered scheme, and how long that's good for, or 0 if it
+// doesn't expire
+func (cf *ConfFlags) resolveArg(a Arg) (string, time.Duration, error) {
+	var (
+		v   string
+		ttl time.Duration
+		err error
+	)
+	if strings.HasPrefix(a.Value, "@") {
+		v, err = fileValue(a)
+	} else {
+		v, ttl, err = resolveValue(a.Value)
+	}
+	if nil != err {
+		return "", 0, fmt.Errorf("unable to resolve %v: %v",
+			cf.redactValue(a.Key, a.Value), err)
+	}
+	return v, ttl, nil
+}
+
+/* isReference reports whether v would be resolved by a Resolver */
+func isReference(v string) bool {
+	_, ok := resolverFor(v)
+	return ok && !strings.HasPrefix(v[strings.Index(v, ":")+1:], ":")
+}
+
+// escapeValue returns v escaped so it's read back from the config as it is,
+// and not as a reference: a leading @ is doubled, each ${ becomes $${, and
+// the colon after a registered scheme is doubled
+func escapeValue(v string) string {
+	v = strings.Replace(v, "${", "$${", -1)
+	if strings.HasPrefix(v, "@") {
+		return "@" + v
+	}
+	if _, ok := resolverFor(v); ok {
+		i := strings.Index(v, ":")
+		return v[:i] + ":" + v[i:]
+	}
+	return v
+}
+
+/* resolverFor returns the Resolver for v's scheme, if there is one */
+func resolverFor(v string) (ttlResolver, bool) {
+	i := strings.Index(v, ":")
+	if 0 >= i {
+		return nil, false
+	}
+	resolverLock.Lock()
+	defer resolverLock.Unlock()
+	r, ok := resolvers[v[:i]]
+	return r, ok
+}
+
+// secretField returns the value of key in the secret v, which came from name
+// and must be a JSON object, or v itself if key is ""
+func secretField(v, key, name string) (string, error) {
+	if "" == key {
+		return v, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v), &obj); nil != err {
+		return "", fmt.Errorf("secret %v is not a JSON object", name)
+	}
+	raw, ok := obj[key]
+	if !ok {
+		return "", fmt.Errorf("secret %v has no key %v", name, key)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); nil == err {
+		return s, nil
+	}
+	return string(raw), nil
+}
+
+/* How long to wait before trying again if a refresh didn't work */
+const refreshRetry = 30 * time.Second
+
+/* When resolved values expire and the config should be read again */
+type resolveState struct {
+	refreshAt time.Time /* Zero if nothing expires; guarded by cond.L */
+}
+
+// setRefresh notes that the config should be read again after ttl, or not
+// at all if ttl is 0, and wakes up the loop which does it
+func (cf *ConfFlags) setRefresh(ttl time.Duration) {
+	cf.cond.L.Lock()
+	defer cf.cond.L.Unlock()
+	cf.refreshAt = time.Time{}
+	if 0 != ttl {
+		cf.refreshAt = now().Add(ttl)
+	}
+	cf.cond.Broadcast()
+}
+
+// refreshWhenExpired re-reads the config when resolved values expire,
+// sending the results to c, until cf is shut down
+func (cf *ConfFlags) refreshWhenExpired(c chan UpdateResult) {
+	for {
+		/* Wait for something to expire */
+		cf.cond.L.Lock()
+		for cf.refreshAt.IsZero() && !cf.stopped() {
+			cf.cond.Wait()
+		}
+		t := cf.refreshAt
+		cf.cond.L.Unlock()
+		if !cf.sleepUnlessStopped(t.Sub(now())) {
+			return
+		}
+
+		/* The time may have moved since we went to sleep */
+		cf.cond.L.Lock()
+		due := !cf.refreshAt.IsZero() && !now().Before(cf.refreshAt)
+		cf.cond.L.Unlock()
+		if !due {
+			continue
+		}
+		cf.sendResult(c, cf.updateConfig())
+
+		/* Don't spin if the refresh failed */
+		cf.cond.L.Lock()
+		if !cf.refreshAt.IsZero() && !now().Before(cf.refreshAt) {
+			cf.refreshAt = now().Add(refreshRetry)
+		}
+		cf.cond.L.Unlock()
+	}
+}
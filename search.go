@@ -0,0 +1,119 @@
+package confflags
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/* Where to look for a config file if there's no -config */
+type searchState struct {
+	searchPaths []string
+	searchLock  sync.Mutex /* Also guards -config */
+}
+
+// SetSearchPaths sets the config files to look for if -config isn't given.
+// Whenever the config would be read, the first of paths which exists is
+// read as if it had been given with -config.  If none exist, there is no
+// config file.  SearchPaths gives the usual locations for a program.  With
+// no paths, the default, no search is made.
+func SetSearchPaths(paths ...string) {
+	std.SetSearchPaths(paths...)
+}
+
+// SetSearchPaths sets the config files to look for if -config isn't given
+// to cf's FlagSet.  See the package-level SetSearchPaths.
+func (cf *ConfFlags) SetSearchPaths(paths ...string) {
+	cf.searchLock.Lock()
+	defer cf.searchLock.Unlock()
+	cf.searchPaths = append([]string(nil), paths...)
+}
+
+// SearchPaths returns the conventional places to look for the config file
+// for the program named app, in order:
+//
+//	./app.conf
+//	$XDG_CONFIG_HOME/app/app.conf (or ~/.config/app/app.conf)
+//	/etc/app/app.conf
+//
+// for use with SetSearchPaths, e.g.
+//
+//	confflags.SetSearchPaths(confflags.SearchPaths("myserver")...)
+//
+// If app is "", the name returned by BinaryName is used, so every binary
+// built from the same code looks for its own config file.
+func SearchPaths(app string) []string {
+	if "" == app {
+		app = BinaryName()
+	}
+	name := app + ".conf"
+	paths := []string{name}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if "" == dir {
+		if home, err := os.UserHomeDir(); nil == err {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if "" != dir {
+		paths = append(paths, filepath.Join(dir, app, name))
+	}
+	return append(paths, filepath.Join("/etc", app, name))
+}
+
+// BinaryName returns the name of the running program, taken from
+// os.Args[0] without its directory or any .exe extension.
+func BinaryName() string {
+	name := filepath.Base(os.Args[0])
+	if strings.EqualFold(".exe", filepath.Ext(name)) {
+		name = name[:len(name)-len(".exe")]
+	}
+	return name
+}
+
+// configPaths returns the config files given with -config or, if there are
+// none, the first of the search paths which exists
+func (cf *ConfFlags) configPaths() []string {
+	cf.searchLock.Lock()
+	defer cf.searchLock.Unlock()
+	if paths := cf.config.paths(); 0 != len(paths) {
+		return paths
+	}
+	for _, path := range cf.searchPaths {
+		if _, err := os.Stat(path); nil == err {
+			return []string{path}
+		}
+	}
+	return nil
+}
+
+// SetConfigPath changes the config file read by subsequent reloads to path,
+// which may be anything which could be given with -config, e.g. after the
+// file has been moved.  The file is read straight away, and if it can't be
+// read or sets an unknown flag, an error is returned and the config file
+// isn't changed.  The flags aren't updated until the next reload; call
+// Reload to update them straight away.
+func SetConfigPath(path string) error {
+	return std.SetConfigPath(path)
+}
+
+// SetConfigPath changes cf's config file to path.  See the package-level
+// SetConfigPath.
+func (cf *ConfFlags) SetConfigPath(path string) error {
+	var v configValue
+	v.Set(path)
+	if 0 == len(v) {
+		return errors.New("no config file given")
+	}
+	if _, err := cf.fileValues(v...); nil != err {
+		return err
+	}
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.searchLock.Lock()
+	defer cf.searchLock.Unlock()
+	*cf.config = v
+	cf.lastDeps = nil
+	return nil
+}
@@ -0,0 +1,90 @@
+package confflags
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DockerSecretsDir is where Docker Swarm and, by convention, Kubernetes put
+// secrets, one per file.
+const DockerSecretsDir = "/run/secrets"
+
+/* Directory from which flags are set, one file per flag */
+type secretsState struct {
+	secretsDir  string
+	secretsLock sync.Mutex
+}
+
+// SetSecretsDir causes flags in flag.CommandLine to be set from the files in
+// dir with the same names as the flags, less leading and trailing
+// whitespace.  For example, with
+//
+//	confflags.SetSecretsDir(confflags.DockerSecretsDir)
+//
+// /run/secrets/db.password sets -db.password.  Values from these files
+// override those in the config file but are overridden by the environment
+// and the command line.  The files are read whenever the config file is.
+// An empty dir, the default, turns this off.
+func SetSecretsDir(dir string) {
+	std.SetSecretsDir(dir)
+}
+
+// SetSecretsDir causes flags in cf's FlagSet to be set from files in dir.
+// See the package-level SetSecretsDir.
+func (cf *ConfFlags) SetSecretsDir(dir string) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.secretsLock.Lock()
+	defer cf.secretsLock.Unlock()
+	cf.secretsDir = dir
+	cf.lastDeps = nil
+}
+
+/* getSecretsDir returns the directory set with SetSecretsDir */
+func (s *secretsState) getSecretsDir() string {
+	s.secretsLock.Lock()
+	defer s.secretsLock.Unlock()
+	return s.secretsDir
+}
+
+// secretsDirArgs returns Args for the flags with files in the directory set
+// with SetSecretsDir.  The Args' values are of the form @path, so the files
+// are read as other @path values are.
+func (cf *ConfFlags) secretsDirArgs() []Arg {
+	dir := cf.getSecretsDir()
+	if "" == dir {
+		return nil
+	}
+	var args []Arg
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		path := filepath.Join(dir, f.Name)
+		if fi, err := os.Stat(path); nil != err || fi.IsDir() {
+			return
+		}
+		args = append(args, Arg{
+			Key:      f.Name,
+			Value:    "@" + path,
+			FilePath: path,
+			kind:     argFile,
+		})
+	})
+	return args
+}
+
+// noteSecretsDir notes the files in the directory set with SetSecretsDir in
+// deps, so that changing, adding, or removing one causes the config to be
+// read again
+func (cf *ConfFlags) noteSecretsDir(deps *configDeps) {
+	dir := cf.getSecretsDir()
+	if "" == dir {
+		return
+	}
+	pattern := filepath.Join(dir, "*")
+	matches, _ := filepath.Glob(pattern)
+	deps.addGlob(pattern, matches)
+	for _, m := range matches {
+		deps.addFile(m)
+	}
+}
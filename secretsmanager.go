@@ -0,0 +1,41 @@
+package confflags
+
+import "strings"
+
+// resolveAWSSecret returns the secret named by ref from AWS Secrets Manager.
+// ref is the secret's name or ARN, optionally followed by # and a key, in
+// which case the secret must be a JSON object and the value of the key is
+// returned.  The region is taken from an ARN, or is the default region.
+func resolveAWSSecret(ref string) (string, error) {
+	id, key := ref, ""
+	if i := strings.LastIndex(ref, "#"); -1 != i {
+		id, key = ref[:i], ref[i+1:]
+	}
+
+	/* ARNs say where they are */
+	var region string
+	if parts := strings.Split(id, ":"); strings.HasPrefix(id, "arn:") &&
+		4 < len(parts) {
+		region = parts[3]
+	} else {
+		var err error
+		if region, err = awsRegion(); nil != err {
+			return "", err
+		}
+	}
+
+	var res struct {
+		SecretString string
+		SecretBinary []byte
+	}
+	if err := awsCall("secretsmanager", region, "secretsmanager",
+		"GetSecretValue", map[string]string{"SecretId": id},
+		&res); nil != err {
+		return "", err
+	}
+	v := res.SecretString
+	if nil != res.SecretBinary {
+		v = string(res.SecretBinary)
+	}
+	return secretField(v, key, id)
+}
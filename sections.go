@@ -0,0 +1,53 @@
+package confflags
+
+import "sync"
+
+/* Flag name prefixes for config file sections */
+type sectionState struct {
+	sectionPrefixes map[string]string
+	sectionLock     sync.Mutex
+}
+
+func (s *sectionState) init() {
+	s.sectionPrefixes = make(map[string]string)
+}
+
+// MapSection causes keys in the config file which follow a [section] line to
+// be taken as the names of flags starting with prefix.  For example, with
+//
+//	confflags.MapSection("server", "http-")
+//
+// the lines
+//
+//	[server]
+//	port 8080
+//
+// set the flag named http-port.  The prefix may be empty.  Sections which
+// haven't been mapped use the section name and a . as the prefix, so keys
+// in [db] set flags named db.key.
+func MapSection(section, prefix string) {
+	std.MapSection(section, prefix)
+}
+
+// MapSection causes keys in cf's config file which follow a [section] line
+// to be taken as the names of flags starting with prefix.  See the
+// package-level MapSection.
+func (cf *ConfFlags) MapSection(section, prefix string) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.sectionLock.Lock()
+	defer cf.sectionLock.Unlock()
+	cf.sectionPrefixes[section] = prefix
+	cf.lastDeps = nil
+}
+
+/* sectionKey returns the flag name for key in the given section */
+func (s *sectionState) sectionKey(section, key string) string {
+	s.sectionLock.Lock()
+	defer s.sectionLock.Unlock()
+	prefix, ok := s.sectionPrefixes[section]
+	if !ok {
+		prefix = section + "."
+	}
+	return prefix + key
+}
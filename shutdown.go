@@ -0,0 +1,168 @@
+package confflags
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/* Shutdown state */
+type shutdownState struct {
+	results    chan UpdateResult /* Channel passed to Parse */
+	stopCh     chan struct{}
+	dropCh     chan struct{}
+	stopOnce   sync.Once
+	dropOnce   sync.Once
+	closeOnce  sync.Once
+	loopWG     sync.WaitGroup /* Interval, schedule, and signal loops */
+	callbackWG sync.WaitGroup /* Running flag change callbacks */
+	sendWG     sync.WaitGroup /* Undelivered UpdateResults */
+}
+
+func (s *shutdownState) init() {
+	s.stopCh = make(chan struct{})
+	s.dropCh = make(chan struct{})
+}
+
+// Shutdown stops confflags: SIGHUP is no longer caught and the config is no
+// longer re-read on -configUpdateInterval or -configUpdateSchedule.  It then
+// waits for running flag change callbacks to return and for pending
+// UpdateResults to be received from the channel passed to Parse.  If ctx is
+// done first, the pending UpdateResults are dropped and ctx.Err() is
+// returned.  If closeChan is true, the channel passed to Parse is closed once
+// nothing more will be sent on it.  Shutdown may be called more than once,
+// but the channel is only closed once.
+func Shutdown(ctx context.Context, closeChan bool) error {
+	return std.Shutdown(ctx, closeChan)
+}
+
+// Shutdown stops cf from catching SIGHUP and re-reading its config file,
+// and waits for its callbacks and pending UpdateResults.  See the
+// package-level Shutdown.
+func (cf *ConfFlags) Shutdown(ctx context.Context, closeChan bool) error {
+	/* Stop the loops, waking the ones waiting for a change */
+	cf.stopOnce.Do(func() {
+		cf.cond.L.Lock()
+		close(cf.stopCh)
+		cf.cond.Broadcast()
+		cf.cond.L.Unlock()
+	})
+
+	/* Wait for the loops to exit, then for callbacks and sends */
+	var err error
+	for _, wg := range []*sync.WaitGroup{&cf.loopWG, &cf.callbackWG,
+		&cf.sendWG} {
+		if err = waitContext(ctx, wg); nil != err {
+			break
+		}
+	}
+
+	/* Drop whatever wasn't delivered */
+	if nil != err {
+		cf.dropOnce.Do(func() { close(cf.dropCh) })
+	}
+
+	/* Close the channel once nothing else will send on it */
+	if closeChan && nil != cf.results {
+		cf.loopWG.Wait()
+		cf.sendWG.Wait()
+		cf.closeResults()
+	}
+	return err
+}
+
+// Close stops flag.CommandLine's config from being re-read, as with
+// Shutdown, drops any UpdateResults not yet received, closes the channel
+// passed to Parse, and waits for running flag change callbacks to return.
+// It always returns nil.
+func Close() error {
+	return std.Close()
+}
+
+// Close tears down cf.  See the package-level Close.
+func (cf *ConfFlags) Close() error {
+	/* A done context means nothing's waited for */
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cf.Shutdown(ctx, true)
+	cf.callbackWG.Wait()
+	return nil
+}
+
+// ParseContext is like Parse, but calls Shutdown when ctx is done, so that
+// flag.CommandLine's config stops being re-read.  UpdateResults not yet
+// received from c when ctx is done are dropped.
+func ParseContext(ctx context.Context, c chan UpdateResult) error {
+	return std.ParseContext(ctx, c)
+}
+
+// ParseContext is like cf.Parse, but calls cf.Shutdown when ctx is done.
+// See the package-level ParseContext.
+func (cf *ConfFlags) ParseContext(ctx context.Context,
+	c chan UpdateResult) error {
+	if err := cf.Parse(c); nil != err {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			/* ctx is done, so nothing's waited for */
+			cf.Shutdown(ctx, false)
+		case <-cf.stopCh:
+		}
+	}()
+	return nil
+}
+
+/* closeResults closes the channel passed to Parse, once */
+func (s *shutdownState) closeResults() {
+	s.closeOnce.Do(func() { close(s.results) })
+}
+
+/* waitContext waits for wg, or returns ctx.Err() if ctx is done first */
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/* stopped returns true if Shutdown has been called */
+func (s *shutdownState) stopped() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleepUnlessStopped sleeps for d and returns true, or returns false early if
+// Shutdown is called.
+func (s *shutdownState) sleepUnlessStopped(d time.Duration) bool {
+	select {
+	case <-after(d):
+		return !s.stopped()
+	case <-s.stopCh:
+		return false
+	}
+}
+
+// waitForChange waits for the update interval or schedule to change, and
+// returns false if Shutdown was called.
+func (cf *ConfFlags) waitForChange() bool {
+	cf.cond.L.Lock()
+	defer cf.cond.L.Unlock()
+	if cf.stopped() {
+		return false
+	}
+	cf.cond.Wait()
+	return !cf.stopped()
+}
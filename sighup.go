@@ -0,0 +1,12 @@
+//go:build !js
+
+package confflags
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultSignal is the signal which, unless changed, causes the config to be
+// re-read and is sent to children.  On plan9 it's the hangup note.
+var defaultSignal os.Signal = syscall.SIGHUP
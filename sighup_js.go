@@ -0,0 +1,8 @@
+package confflags
+
+import "os"
+
+// There are no signals under js/wasm, so by default none cause the config to
+// be re-read and children aren't signalled.  Reload and TriggerReload still
+// work.
+var defaultSignal os.Signal
@@ -0,0 +1,138 @@
+package confflags
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+/* How signals which cause the config to be re-read are handled */
+type signalState struct {
+	reloadSignals  []os.Signal
+	signalCh       chan os.Signal /* Set by Parse */
+	signalDebounce time.Duration
+	signalLock     sync.Mutex
+}
+
+func (s *signalState) init() {
+	if nil != defaultSignal {
+		s.reloadSignals = []os.Signal{defaultSignal}
+	}
+}
+
+// SetReloadSignals sets the signals which cause the config to be re-read,
+// e.g. SIGUSR1 for a program which already uses SIGHUP to reopen its logs.
+// The default is SIGHUP, or no signals under js/wasm.  With no signals,
+// signals don't cause reloads.  It may be called before or after Parse.
+func SetReloadSignals(sigs ...os.Signal) {
+	std.SetReloadSignals(sigs...)
+}
+
+// SetReloadSignals sets the signals which cause cf's config to be re-read.
+// See the package-level SetReloadSignals.
+func (cf *ConfFlags) SetReloadSignals(sigs ...os.Signal) {
+	cf.signalLock.Lock()
+	defer cf.signalLock.Unlock()
+	cf.reloadSignals = append([]os.Signal(nil), sigs...)
+	if nil == cf.signalCh {
+		return
+	}
+	signal.Stop(cf.signalCh)
+	if 0 != len(cf.reloadSignals) {
+		signal.Notify(cf.signalCh, cf.reloadSignals...)
+	}
+}
+
+// DisableSignals stops confflags from handling signals at all, for programs
+// or frameworks which handle signals themselves.  If called before Parse,
+// signal.Notify is never called.  The config may still be re-read with
+// Reload.  It's the same as calling SetReloadSignals with no signals.
+func DisableSignals() {
+	std.DisableSignals()
+}
+
+// DisableSignals stops cf from handling signals.  See the package-level
+// DisableSignals.
+func (cf *ConfFlags) DisableSignals() {
+	cf.SetReloadSignals()
+}
+
+// notifySignals starts catching the reload signals and returns the channel
+// on which they'll arrive
+func (cf *ConfFlags) notifySignals() <-chan os.Signal {
+	cf.signalLock.Lock()
+	defer cf.signalLock.Unlock()
+	cf.signalCh = make(chan os.Signal, 1)
+	if 0 != len(cf.reloadSignals) {
+		signal.Notify(cf.signalCh, cf.reloadSignals...)
+	}
+	return cf.signalCh
+}
+
+/* stopSignals stops catching the reload signals */
+func (cf *ConfFlags) stopSignals() {
+	cf.signalLock.Lock()
+	defer cf.signalLock.Unlock()
+	signal.Stop(cf.signalCh)
+	cf.signalCh = nil
+}
+
+// SetSignalDebounce causes signals which arrive within d of each other, such
+// as a burst of SIGHUPs from a config management tool, to cause a single
+// reload, made once d has passed without another signal.  The default, 0,
+// causes a reload for every signal.
+func SetSignalDebounce(d time.Duration) {
+	std.SetSignalDebounce(d)
+}
+
+// SetSignalDebounce sets how long cf waits for a burst of signals to end
+// before re-reading the config.  See the package-level SetSignalDebounce.
+func (cf *ConfFlags) SetSignalDebounce(d time.Duration) {
+	cf.signalLock.Lock()
+	defer cf.signalLock.Unlock()
+	cf.signalDebounce = d
+}
+
+// reloadOnSignals re-reads the config whenever a signal arrives on ch or
+// TriggerReload is called, sending the results to c, until cf is shut down
+func (cf *ConfFlags) reloadOnSignals(c chan UpdateResult,
+	ch <-chan os.Signal) {
+	for {
+		/* Catch a signal */
+		select {
+		case <-ch:
+		case <-cf.reloadRequests:
+		case <-cf.stopCh:
+			return
+		}
+		/* Wait for any more to stop coming */
+		if !cf.awaitQuiet(ch) {
+			return
+		}
+		/* Update the state */
+		cf.sendResult(c, cf.updateConfig())
+	}
+}
+
+// awaitQuiet waits until no signal has arrived on ch, nor has TriggerReload
+// been called, for the debounce window, and returns false if cf is shut down
+// first
+func (cf *ConfFlags) awaitQuiet(ch <-chan os.Signal) bool {
+	for {
+		cf.signalLock.Lock()
+		d := cf.signalDebounce
+		cf.signalLock.Unlock()
+		if 0 >= d {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-cf.reloadRequests:
+		case <-after(d):
+			return true
+		case <-cf.stopCh:
+			return false
+		}
+	}
+}
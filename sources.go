@@ -0,0 +1,335 @@
+package confflags
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Source provides config from somewhere other than a local file, such as a
+// config server.  The Source used is chosen by the scheme of the URL given
+// with -config.
+type Source interface {
+	// Read returns the key/value pairs currently held by the source.
+	Read() ([]Arg, error)
+}
+
+// Watcher may be implemented by a Source which can tell when its config has
+// changed, so it can be re-read right away instead of waiting for the next
+// update interval or SIGHUP.
+type Watcher interface {
+	Source
+	// Watch blocks until the source's config may have changed since it
+	// was last read, and returns nil, or until stop is closed.  It is
+	// called again after each return.  If it returns an error, it's sent
+	// out as a Warning and Watch is called again later.
+	Watch(stop <-chan struct{}) error
+}
+
+// SourceOpener returns a Source for the given URL.
+type SourceOpener func(u *url.URL) (Source, error)
+
+// ErrCircuitOpen is returned when reading from a Source whose circuit
+// breaker is open and which has never been read successfully.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+/* SourceOpeners, by URL scheme */
+var (
+	sourceOpeners = map[string]SourceOpener{
+		"http":  openHTTPSource,
+		"https": openHTTPSource,
+		"etcd":  openEtcdSource,
+		"etcds": openEtcdSource,
+		"ssm":   openSSMSource,
+		"s3":    openS3Source,
+		"gs":    openGCSSource,
+	}
+	openerLock        sync.Mutex
+	errNotASource     = errors.New("not a source")
+	breakerStateNames = []string{"closed", "open", "half-open"}
+)
+
+/* Sources, by -config value */
+type sourceState struct {
+	openSources  map[string]*breaker
+	breakerTrips int           /* Failures to open the circuit */
+	breakerProbe time.Duration /* Time between probes when open */
+	sourceOpened chan struct{} /* Wakes up watchSources */
+	sourceLock   sync.Mutex
+}
+
+func (s *sourceState) init() {
+	s.openSources = make(map[string]*breaker)
+	s.sourceOpened = make(chan struct{}, 1)
+	s.breakerTrips = 3
+	s.breakerProbe = 30 * time.Second
+}
+
+// RegisterSource causes -config values which are URLs with the given scheme
+// (e.g. "etcd" for etcd://host/prefix) to be read by the Source returned by
+// open.  open is called the first time the URL is read.  http and https URLs
+// are fetched with HTTPClient, etcd and etcds URLs are read from etcd, ssm
+// URLs are read from AWS Systems Manager Parameter Store, and s3 and gs URLs
+// are read from objects in S3 and Google Cloud Storage, unless another Source
+// is registered for them.
+//
+// Sources are read through a circuit breaker.  After a number of
+// consecutive failures (see SetCircuitBreaker) the circuit opens: the source
+// isn't read again until the probe interval has passed, and the last values
+// read successfully are used in the meantime.  Changes in the circuit's
+// state are sent out as Warnings.
+func RegisterSource(scheme string, open SourceOpener) {
+	openerLock.Lock()
+	defer openerLock.Unlock()
+	sourceOpeners[scheme] = open
+}
+
+// SetCircuitBreaker sets the number of consecutive failures after which a
+// Source's circuit breaker opens and the time after which an open circuit is
+// probed by reading the source again.  The defaults are 3 and 30 seconds.
+func SetCircuitBreaker(failures int, probe time.Duration) {
+	std.SetCircuitBreaker(failures, probe)
+}
+
+// SetCircuitBreaker sets the circuit breaker settings for cf's Sources.  See
+// the package-level SetCircuitBreaker.
+func (cf *ConfFlags) SetCircuitBreaker(failures int, probe time.Duration) {
+	cf.sourceLock.Lock()
+	defer cf.sourceLock.Unlock()
+	cf.breakerTrips = failures
+	cf.breakerProbe = probe
+}
+
+// SourceStatus describes the state of a Source's circuit breaker.
+type SourceStatus struct {
+	Name      string    /* The -config value */
+	State     string    /* closed, open, or half-open */
+	Failures  int       /* Consecutive failures */
+	LastError error     /* Most recent error, if any */
+	Since     time.Time /* When the circuit entered its current state */
+}
+
+// StatusReport describes the state of confflags.
+type StatusReport struct {
+	Generation int
+	Sources    []SourceStatus /* Sorted by name */
+}
+
+// Status returns the current state of confflags for flag.CommandLine.
+func Status() StatusReport {
+	return std.Status()
+}
+
+// Status returns the current state of cf.
+func (cf *ConfFlags) Status() StatusReport {
+	st := StatusReport{Generation: cf.Generation()}
+	cf.sourceLock.Lock()
+	defer cf.sourceLock.Unlock()
+	for _, b := range cf.openSources {
+		b.lock.Lock()
+		st.Sources = append(st.Sources, SourceStatus{
+			Name:      b.name,
+			State:     breakerStateNames[b.state],
+			Failures:  b.failures,
+			LastError: b.lastErr,
+			Since:     b.since,
+		})
+		b.lock.Unlock()
+	}
+	sort.Slice(st.Sources, func(i, j int) bool {
+		return st.Sources[i].Name < st.Sources[j].Name
+	})
+	return st
+}
+
+/* isSourceURL reports whether name is a URL with a registered scheme */
+func isSourceURL(name string) bool {
+	u, err := url.Parse(name)
+	if nil != err || "" == u.Scheme {
+		return false
+	}
+	openerLock.Lock()
+	defer openerLock.Unlock()
+	_, ok := sourceOpeners[u.Scheme]
+	return ok
+}
+
+// readSource reads the config from the Source for name, or returns
+// errNotASource if name isn't a URL with a registered scheme
+func (cf *ConfFlags) readSource(name string) ([]Arg, error) {
+	cf.sourceLock.Lock()
+	b, ok := cf.openSources[name]
+	if !ok {
+		u, err := url.Parse(name)
+		if nil != err || "" == u.Scheme {
+			cf.sourceLock.Unlock()
+			return nil, errNotASource
+		}
+		openerLock.Lock()
+		open, ok := sourceOpeners[u.Scheme]
+		openerLock.Unlock()
+		if !ok {
+			cf.sourceLock.Unlock()
+			return nil, errNotASource
+		}
+		src, err := open(u)
+		if nil != err {
+			cf.sourceLock.Unlock()
+			return nil, fmt.Errorf("unable to open %v: %v", name,
+				err)
+		}
+		if o, ok := src.(ownedSource); ok {
+			o.setOwner(cf)
+		}
+		b = &breaker{src: src, name: name, since: now(), warn: cf.warn}
+		cf.openSources[name] = b
+		select {
+		case cf.sourceOpened <- struct{}{}:
+		default:
+		}
+	}
+	trips, probe := cf.breakerTrips, cf.breakerProbe
+	cf.sourceLock.Unlock()
+	return b.read(trips, probe)
+}
+
+// watchSources re-reads the config whenever a Source which is a Watcher says
+// its config has changed, sending the results to c, until cf is shut down
+func (cf *ConfFlags) watchSources(c chan UpdateResult) {
+	changed := make(chan struct{}, 1)
+	watching := make(map[string]bool)
+	for {
+		/* Watch any Sources we're not already watching */
+		cf.sourceLock.Lock()
+		for name, b := range cf.openSources {
+			w, ok := b.src.(Watcher)
+			if !ok || watching[name] {
+				continue
+			}
+			watching[name] = true
+			cf.loopWG.Add(1)
+			go cf.watchSource(w, name, changed)
+		}
+		cf.sourceLock.Unlock()
+
+		select {
+		case <-changed:
+			cf.sendResult(c, cf.updateConfig())
+		case <-cf.sourceOpened:
+		case <-cf.stopCh:
+			return
+		}
+	}
+}
+
+// watchSource waits for changes to w's config, noting them in changed, until
+// cf is shut down.  Errors are retried after the circuit breaker's probe
+// interval.
+func (cf *ConfFlags) watchSource(w Watcher, name string,
+	changed chan<- struct{}) {
+	defer cf.loopWG.Done()
+	for {
+		err := w.Watch(cf.stopCh)
+		if cf.stopped() {
+			return
+		}
+		if nil != err {
+			cf.warn([]Warning{{Arg{FilePath: name},
+				fmt.Sprintf("unable to watch for changes: %v",
+					err)}})
+			cf.sourceLock.Lock()
+			probe := cf.breakerProbe
+			cf.sourceLock.Unlock()
+			if !cf.sleepUnlessStopped(probe) {
+				return
+			}
+			continue
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/* Circuit breaker states */
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+/* breaker is a circuit breaker around a Source */
+type breaker struct {
+	src      Source
+	name     string
+	state    int
+	failures int
+	lastErr  error
+	since    time.Time
+	lastGood []Arg /* Last successful read */
+	haveGood bool
+	warn     func([]Warning) /* Sends out warnings */
+	lock     sync.Mutex
+}
+
+// read reads from the source, unless the circuit is open, in which case the
+// last good values are returned.  trips and probe are as for
+// SetCircuitBreaker.
+func (b *breaker) read(trips int, probe time.Duration) ([]Arg, error) {
+	b.lock.Lock()
+	/* Don't bother the source if it's been failing */
+	if breakerOpen == b.state {
+		if now().Sub(b.since) < probe {
+			defer b.lock.Unlock()
+			return b.good()
+		}
+		b.setState(breakerHalfOpen, nil)
+	}
+	b.lock.Unlock()
+
+	/* The source may be slow, so Status isn't held up while reading */
+	args, err := b.src.Read()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if nil == err {
+		b.failures = 0
+		b.lastGood, b.haveGood = args, true
+		if breakerClosed != b.state {
+			b.setState(breakerClosed, nil)
+		}
+		return args, nil
+	}
+
+	/* Open the circuit if it's failed too much */
+	b.failures++
+	b.lastErr = err
+	if breakerHalfOpen == b.state || (0 < trips && b.failures >= trips) {
+		b.setState(breakerOpen, err)
+		return b.good()
+	}
+	return nil, err
+}
+
+/* good returns the last good values, if there are any */
+func (b *breaker) good() ([]Arg, error) {
+	if !b.haveGood {
+		return nil, ErrCircuitOpen
+	}
+	return b.lastGood, nil
+}
+
+/* setState changes the breaker's state and sends out a warning about it */
+func (b *breaker) setState(state int, err error) {
+	b.state = state
+	b.since = now()
+	msg := fmt.Sprintf("circuit %v", breakerStateNames[state])
+	if nil != err {
+		msg += fmt.Sprintf(" after %v failures: %v", b.failures, err)
+	}
+	b.warn([]Warning{{Arg{FilePath: b.name}, msg}})
+}
@@ -0,0 +1,75 @@
+package confflags
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ssmSource is a Source which reads the parameters under a path from AWS
+// Systems Manager Parameter Store.  ssm:///app/prod/ reads the parameters
+// under /app/prod/ in the default region, and ssm://eu-west-1/app/prod/ those
+// in eu-west-1.  The rest of each parameter's name, slashes replaced by
+// dots, is the flag name, so /app/prod/http/port sets -http.port.
+// SecureStrings are decrypted.  Credentials are found as described in
+// aws.go.
+type ssmSource struct {
+	region string /* "" for the default */
+	path   string
+}
+
+/* openSSMSource returns a Source for the ssm URL u */
+func openSSMSource(u *url.URL) (Source, error) {
+	p := u.Path
+	if "" == p {
+		p = "/"
+	}
+	return &ssmSource{region: u.Host, path: p}, nil
+}
+
+func (s *ssmSource) Read() ([]Arg, error) {
+	region := s.region
+	if "" == region {
+		var err error
+		if region, err = awsRegion(); nil != err {
+			return nil, err
+		}
+	}
+
+	/* Get every page of parameters */
+	var args []Arg
+	req := struct {
+		Path           string
+		Recursive      bool
+		WithDecryption bool
+		NextToken      string `json:",omitempty"`
+	}{Path: s.path, Recursive: true, WithDecryption: true}
+	for {
+		var res struct {
+			Parameters []struct {
+				Name  string
+				Value string
+			}
+			NextToken string
+		}
+		if err := awsCall("ssm", region, "AmazonSSM",
+			"GetParametersByPath", req, &res); nil != err {
+			return nil, err
+		}
+		for _, p := range res.Parameters {
+			k := strings.Trim(strings.TrimPrefix(p.Name, s.path),
+				"/")
+			if "" == k {
+				continue
+			}
+			args = append(args, Arg{
+				Key:      strings.Replace(k, "/", ".", -1),
+				Value:    p.Value,
+				FilePath: "ssm://" + region + p.Name,
+			})
+		}
+		if "" == res.NextToken {
+			return args, nil
+		}
+		req.NextToken = res.NextToken
+	}
+}
@@ -0,0 +1,225 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/* stagedFlag is a new value for a flag, checked before it's set */
+type stagedFlag struct {
+	f    *flag.Flag
+	v    string
+	desc string /* What's being set, for errors */
+	then string /* What f will report once set, if known */
+	arg  *Arg   /* Where v came from, or nil for a default */
+	/* Values to append to an Appender, the last being v, or nil */
+	vs []string
+	/* Where the values in vs came from, the last being arg */
+	lines []Arg
+}
+
+// checkStaged makes sure each flag in staged will take its new value, as far
+// as can be told without setting it, noting what it will report, and then
+// calls the validators with every flag's value as it would be once the
+// staged values are set
+func (cf *ConfFlags) checkStaged(staged []stagedFlag) error {
+	if err := cf.normalizeStaged(staged); nil != err {
+		return err
+	}
+	snapshot := make(map[string]string)
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		snapshot[f.Name] = f.Value.String()
+	})
+	for _, s := range staged {
+		snapshot[s.f.Name] = s.then
+	}
+	return cf.validate(snapshot)
+}
+
+// normalizeStaged notes what each flag in staged will report once it's set,
+// as far as can be told without setting it, or returns an error if a flag
+// won't take its new value
+func (cf *ConfFlags) normalizeStaged(staged []stagedFlag) error {
+	for i, s := range staged {
+		v, err := s.value()
+		if nil != err {
+			return fmt.Errorf("unable to set %v: %v", s.desc,
+				cf.redactErr(s.f.Name, err))
+		}
+		staged[i].then = v
+	}
+	return nil
+}
+
+// value returns what s's flag would report if set to its new value or
+// values.  A list whose flag's Value can't be copied safely is joined with
+// commas.
+func (s stagedFlag) value() (string, error) {
+	if nil == s.vs {
+		return stagedValue(s.f, s.v)
+	}
+	sh, ok := s.f.Value.(shadower)
+	if !ok {
+		return strings.Join(s.vs, ","), nil
+	}
+	a, ok := sh.shadow().(Appender)
+	if !ok {
+		return strings.Join(s.vs, ","), nil
+	}
+	a.Reset()
+	for _, v := range s.vs {
+		if err := a.Append(v); nil != err {
+			return "", err
+		}
+	}
+	return a.String(), nil
+}
+
+// shadower is implemented by this package's flag.Values, which can make
+// copies of themselves to be set without side effects
+type shadower interface {
+	shadow() flag.Value
+}
+
+// stagedValue returns the value f would report if set to v, or an error if
+// it wouldn't take v.  It's worked out with a copy of f's Value if that can
+// be made safely, i.e. the Value is one of the flag package's numbers,
+// strings, or bools.  Otherwise v is returned and any error won't be found
+// until f is set, as setting a copy of another Value might have side effects.
+func stagedValue(f *flag.Flag, v string) (string, error) {
+	if sh, ok := f.Value.(shadower); ok {
+		shadow := sh.shadow()
+		if err := setFlagValue(&flag.Flag{Name: f.Name, Value: shadow},
+			v); nil != err {
+			return "", err
+		}
+		return shadow.String(), nil
+	}
+	rv := reflect.ValueOf(f.Value)
+	if reflect.Ptr != rv.Kind() || rv.IsNil() ||
+		"flag" != rv.Elem().Type().PkgPath() {
+		return v, nil
+	}
+	switch rv.Elem().Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32,
+		reflect.Float64, reflect.String:
+	default:
+		return v, nil
+	}
+	c := reflect.New(rv.Elem().Type())
+	c.Elem().Set(rv.Elem())
+	shadow, ok := c.Interface().(flag.Value)
+	if !ok {
+		return v, nil
+	}
+	if err := setFlagValue(&flag.Flag{Name: f.Name, Value: shadow},
+		v); nil != err {
+		return "", err
+	}
+	return shadow.String(), nil
+}
+
+// argPlan is what applying some Args would do, worked out without touching
+// the flags
+type argPlan struct {
+	staged   []stagedFlag      /* New values, in the order to set them */
+	origins  map[string]string /* Where flags got their values */
+	reset    []string          /* Flags going back to their defaults */
+	ttl      time.Duration     /* Until a resolved value expires, or 0 */
+	unknown  []Arg             /* Keys which aren't flags */
+	extras   map[string]string /* Those keys' values, if kept */
+	warnings []Warning
+}
+
+// planArgs works out the new values of the flags in missingFlags from
+// parsedArgs and, if others is true, the secrets directory, systemd
+// credentials, and the environment.  If resetMissing is true, flags in
+// missingFlags without new values go back to their defaults.
+func (cf *ConfFlags) planArgs(parsedArgs []Arg,
+	missingFlags map[string]*flag.Flag, resetMissing,
+	others bool) (*argPlan, error) {
+	p := &argPlan{
+		origins: make(map[string]string),
+		extras:  make(map[string]string),
+	}
+
+	/* The last line for each flag wins, with the current namespace
+	overriding the rest of the config, files in the secrets directory and
+	then systemd credentials overriding that, and the environment
+	overriding everything else */
+	var otherArgs []Arg
+	if others {
+		envArgs, err := cf.envArgs()
+		if nil != err {
+			return nil, err
+		}
+		otherArgs = append(append(cf.secretsDirArgs(),
+			cf.credentialArgs()...), envArgs...)
+	}
+	parsedArgs, warnings := cf.renameKeys(cf.selectNamespace(parsedArgs))
+	/* Repeated keys in the config add to lists */
+	parsedArgs, lists := cf.collectLists(parsedArgs)
+	otherArgs, ows := cf.renameKeys(otherArgs)
+	warnings = append(warnings, ows...)
+	parsedArgs, dws := dedupeArgs(append(parsedArgs, otherArgs...))
+	p.warnings = append(warnings, dws...)
+
+	/* Stage values in the config file for flags which weren't specified
+	on the command line */
+	for _, arg := range parsedArgs {
+		/* Make sure the key from the config file is actually a flag */
+		f := cf.fs.Lookup(arg.Key)
+		if f == nil {
+			ws, err := cf.unknownKey(arg, p.extras)
+			if nil != err {
+				return nil, err
+			}
+			p.warnings = append(p.warnings, ws...)
+			p.unknown = append(p.unknown, arg)
+			continue
+		}
+		if _, found := missingFlags[f.Name]; found {
+			a := arg
+			sf := stagedFlag{f: f, v: arg.Value,
+				desc: fmt.Sprintf("%v to %v, from %v", arg.Key,
+					cf.redactValue(f.Name, arg.Value),
+					arg.location()), arg: &a}
+			if lines, list := lists[arg]; list {
+				sf.lines = lines
+			}
+			p.staged = append(p.staged, sf)
+			/* Note that we've got a value */
+			delete(missingFlags, f.Name) /* Not needing setting */
+			p.origins[f.Name] = arg.location()
+		} else if v := f.Value.String(); v != arg.Value {
+			p.warnings = append(p.warnings, Warning{arg, fmt.Sprintf(
+				"%v set to %v on the command line", f.Name,
+				cf.redactValue(f.Name, v))})
+		}
+	}
+
+	/* Stage the rest of the flags missing from the command line and the
+	config file (back) to their default values */
+	if !resetMissing {
+		missingFlags = nil
+	}
+	for _, f := range missingFlags {
+		p.reset = append(p.reset, f.Name)
+		p.staged = append(p.staged, stagedFlag{f: f, v: f.DefValue,
+			desc: fmt.Sprintf("%v to default value %v", f.Name,
+				cf.redactValue(f.Name, f.DefValue))})
+	}
+
+	/* Values may refer to other flags, files, and secrets */
+	ttl, err := cf.resolveStaged(p.staged)
+	if nil != err {
+		return nil, err
+	}
+	p.ttl = ttl
+	return p, nil
+}
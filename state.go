@@ -0,0 +1,86 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+)
+
+// State is a snapshot of the values of all of the flags, Generation, and the
+// callbacks registered with OnFlagChange and OnAnyFlagChange, taken by
+// SaveState.
+type State struct {
+	values       map[string]string
+	generation   int
+	callbacks    map[string][]*callbackReg
+	anyCallbacks []*callbackReg
+	parsed       bool
+}
+
+// SaveState takes a snapshot of the current state, for restoring later with
+// RestoreState.  This is meant for tests which change the config.
+func SaveState() State {
+	return std.SaveState()
+}
+
+// SaveState takes a snapshot of the current state of cf, for restoring later
+// with cf.RestoreState.
+func (cf *ConfFlags) SaveState() State {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	s := State{
+		values:    make(map[string]string),
+		callbacks: make(map[string][]*callbackReg),
+		parsed:    cf.parsed,
+	}
+	cf.fs.VisitAll(func(f *flag.Flag) {
+		s.values[f.Name] = f.Value.String()
+	})
+	s.generation = cf.Generation()
+	cf.callbackLock.Lock()
+	defer cf.callbackLock.Unlock()
+	for k, v := range cf.flagChangeCallbacks {
+		s.callbacks[k] = append([]*callbackReg{}, v...)
+	}
+	s.anyCallbacks = append([]*callbackReg{}, cf.anyChangeCallbacks...)
+	return s
+}
+
+// RestoreState restores the flags, Generation, and callbacks to their state
+// when s was taken by SaveState.  Callbacks aren't called.  Flags defined
+// since s was taken are left alone.  Note that whether Parse has been called
+// is also restored, but goroutines started by Parse aren't stopped.
+func RestoreState(s State) error {
+	return std.RestoreState(s)
+}
+
+// RestoreState restores cf's flags, generation, and callbacks to their state
+// when s was taken by cf.SaveState.  See the package-level RestoreState.
+func (cf *ConfFlags) RestoreState(s State) error {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	var err error
+	for k, v := range s.values {
+		f := cf.fs.Lookup(k)
+		if nil == f || f.Value.String() == v {
+			continue
+		}
+		if serr := setFlagValue(f, v); nil != serr && nil == err {
+			err = fmt.Errorf("unable to restore %v to %v: %v",
+				k, v, serr)
+		}
+	}
+	cf.generationLock.Lock()
+	*cf.generation = s.generation
+	cf.generationLock.Unlock()
+	cf.callbackLock.Lock()
+	cf.flagChangeCallbacks = make(map[string][]*callbackReg)
+	for k, v := range s.callbacks {
+		cf.flagChangeCallbacks[k] = append([]*callbackReg{}, v...)
+	}
+	cf.anyChangeCallbacks = append([]*callbackReg{}, s.anyCallbacks...)
+	cf.callbackLock.Unlock()
+	cf.parsed = s.parsed
+	/* The config's no longer what the flags were set from */
+	cf.lastDeps = nil
+	return err
+}
@@ -0,0 +1,70 @@
+package confflags
+
+import (
+	"flag"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Threshold causes a callback for a numeric flag to only be called when the
+// flag's value has changed by more than delta or by more than percent
+// percent since the callback was last called.  A zero delta or percent is
+// ignored.  Durations are compared in seconds.  If the flag's value isn't a
+// number, the callback is called on every change.
+func Threshold(delta, percent float64) CallbackOption {
+	return func(o *callbackOpts) {
+		o.threshold = math.Abs(delta)
+		o.thresholdPct = math.Abs(percent)
+		o.hasThreshold = true
+	}
+}
+
+/* noteValue records the current value of f, for thresholds */
+func (reg *callbackReg) noteValue(f *flag.Flag) {
+	if v, ok := numericValue(f); ok {
+		reg.last = v
+	}
+}
+
+// shouldCall reports whether the callback should be called now that f has
+// changed, and notes the current value if so.
+func (reg *callbackReg) shouldCall(f *flag.Flag) bool {
+	if !reg.opts.hasThreshold {
+		return true
+	}
+	v, ok := numericValue(f)
+	if !ok {
+		return true
+	}
+	diff := math.Abs(v - reg.last)
+	call := false
+	switch {
+	case 0 == reg.opts.threshold && 0 == reg.opts.thresholdPct:
+		call = 0 != diff
+	case 0 != reg.opts.threshold && diff > reg.opts.threshold:
+		call = true
+	case 0 != reg.opts.thresholdPct && (0 == reg.last && 0 != diff ||
+		100*diff/math.Abs(reg.last) > reg.opts.thresholdPct):
+		call = true
+	}
+	if call {
+		reg.last = v
+	}
+	return call
+}
+
+/* numericValue returns the value of f as a number, if it is one */
+func numericValue(f *flag.Flag) (float64, bool) {
+	if nil == f {
+		return 0, false
+	}
+	s := f.Value.String()
+	if v, err := strconv.ParseFloat(s, 64); nil == err {
+		return v, true
+	}
+	if d, err := time.ParseDuration(s); nil == err {
+		return d.Seconds(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,447 @@
+package confflags
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// tomlFormat reads and writes TOML.  Tables and dotted keys are flattened to
+// dot-separated flag names, so
+//
+//	[http]
+//	port = 8080
+//
+// sets -http.port.  Arrays are joined with commas.  Arrays of tables aren't
+// supported.
+type tomlFormat struct{}
+
+func (tomlFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	b, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+	p := &tomlParser{s: string(b), line: 1, name: name}
+	if err := p.parse(); nil != err {
+		return nil, err
+	}
+	return p.args, nil
+}
+
+func (tomlFormat) Write(w io.Writer, args []Arg) error {
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "%s = %s\n", tomlKey(arg.Key),
+			tomlQuote(arg.Value)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/* tomlKey returns k as a TOML key, quoted if necessary */
+func tomlKey(k string) string {
+	for _, part := range strings.Split(k, ".") {
+		if "" == part || -1 != strings.IndexFunc(part, func(r rune) bool {
+			return r > 0x7f || !isTOMLBare(byte(r))
+		}) {
+			return tomlQuote(k)
+		}
+	}
+	return k
+}
+
+/* tomlQuote returns s as a TOML basic string */
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case '"' == r || '\\' == r:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n' == r:
+			b.WriteString(`\n`)
+		case '\t' == r:
+			b.WriteString(`\t`)
+		case r < 0x20 || 0x7f == r:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+/* isTOMLBare reports whether c may be in a bare key */
+func isTOMLBare(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || '_' == c || '-' == c
+}
+
+/* tomlParser holds the state of a TOML document being parsed */
+type tomlParser struct {
+	s     string /* The document */
+	pos   int    /* Offset of the next byte in s */
+	line  int    /* Line number of the next byte in s */
+	name  string /* File name, for Args and errors */
+	table string /* Current [table], with a trailing . */
+	args  []Arg
+}
+
+/* errorf returns an error noting the current line */
+func (p *tomlParser) errorf(f string, a ...interface{}) error {
+	return fmt.Errorf("%v in line %v of %v", fmt.Sprintf(f, a...), p.line,
+		p.name)
+}
+
+/* peek returns the next byte, or 0 at the end of the document */
+func (p *tomlParser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+/* next consumes and returns the next byte */
+func (p *tomlParser) next() byte {
+	c := p.peek()
+	p.pos++
+	if '\n' == c {
+		p.line++
+	}
+	return c
+}
+
+/* skipSpace skips spaces and tabs, and newlines and comments if nl is set */
+func (p *tomlParser) skipSpace(nl bool) {
+	for p.pos < len(p.s) {
+		switch c := p.peek(); {
+		case ' ' == c || '\t' == c || '\r' == c:
+			p.next()
+		case nl && '\n' == c:
+			p.next()
+		case nl && '#' == c:
+			for 0 != p.peek() && '\n' != p.peek() {
+				p.next()
+			}
+		default:
+			return
+		}
+	}
+}
+
+/* endLine consumes the rest of a line, which may only hold a comment */
+func (p *tomlParser) endLine() error {
+	p.skipSpace(false)
+	if '#' == p.peek() {
+		for 0 != p.peek() && '\n' != p.peek() {
+			p.next()
+		}
+	}
+	switch p.peek() {
+	case 0, '\n':
+		p.next()
+		return nil
+	}
+	return p.errorf("unexpected %q", p.peek())
+}
+
+/* parse parses the document into p.args */
+func (p *tomlParser) parse() error {
+	for {
+		p.skipSpace(true)
+		switch p.peek() {
+		case 0:
+			return nil
+		case '[':
+			if err := p.parseTable(); nil != err {
+				return err
+			}
+		default:
+			line := p.line
+			key, err := p.parseKey()
+			if nil != err {
+				return err
+			}
+			p.skipSpace(false)
+			if '=' != p.next() {
+				return p.errorf("expected = after %v", key)
+			}
+			p.skipSpace(false)
+			if err := p.parseValue(p.table+key, line); nil != err {
+				return err
+			}
+			if err := p.endLine(); nil != err {
+				return err
+			}
+		}
+	}
+}
+
+/* parseTable parses a [table] header */
+func (p *tomlParser) parseTable() error {
+	p.next()
+	if '[' == p.peek() {
+		return p.errorf("arrays of tables are not supported")
+	}
+	p.skipSpace(false)
+	key, err := p.parseKey()
+	if nil != err {
+		return err
+	}
+	p.skipSpace(false)
+	if ']' != p.next() {
+		return p.errorf("expected ] after [%v", key)
+	}
+	p.table = key + "."
+	return p.endLine()
+}
+
+/* parseKey parses a possibly dotted and quoted key */
+func (p *tomlParser) parseKey() (string, error) {
+	var parts []string
+	for {
+		var part string
+		switch c := p.peek(); {
+		case '"' == c || '\'' == c:
+			var err error
+			if part, err = p.parseString(); nil != err {
+				return "", err
+			}
+		case isTOMLBare(c):
+			start := p.pos
+			for isTOMLBare(p.peek()) {
+				p.next()
+			}
+			part = p.s[start:p.pos]
+		default:
+			return "", p.errorf("expected a key")
+		}
+		parts = append(parts, part)
+		p.skipSpace(false)
+		if '.' != p.peek() {
+			return strings.Join(parts, "."), nil
+		}
+		p.next()
+		p.skipSpace(false)
+	}
+}
+
+// parseValue parses the value for key, which started on line, into
+// p.args.  Inline tables add an Arg for each of their keys.
+func (p *tomlParser) parseValue(key string, line int) error {
+	if '{' == p.peek() {
+		return p.parseInlineTable(key, line)
+	}
+	v, err := p.parseScalar()
+	if nil != err {
+		return err
+	}
+	p.args = append(p.args, Arg{
+		Key:      key,
+		Value:    v,
+		FilePath: p.name,
+		LineNum:  line,
+	})
+	return nil
+}
+
+/* parseInlineTable parses an inline table whose keys are under key */
+func (p *tomlParser) parseInlineTable(key string, line int) error {
+	p.next()
+	for {
+		p.skipSpace(false)
+		if '}' == p.peek() {
+			p.next()
+			return nil
+		}
+		k, err := p.parseKey()
+		if nil != err {
+			return err
+		}
+		p.skipSpace(false)
+		if '=' != p.next() {
+			return p.errorf("expected = after %v", k)
+		}
+		p.skipSpace(false)
+		if err := p.parseValue(key+"."+k, line); nil != err {
+			return err
+		}
+		p.skipSpace(false)
+		switch p.next() {
+		case ',':
+		case '}':
+			return nil
+		default:
+			return p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+/* parseScalar parses a value which isn't an inline table */
+func (p *tomlParser) parseScalar() (string, error) {
+	switch c := p.peek(); c {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return "", p.errorf("inline tables in arrays are not supported")
+	}
+	/* Numbers, booleans, and dates */
+	start := p.pos
+	for c := p.peek(); 0 != c && '\n' != c && '#' != c && ',' != c &&
+		']' != c && '}' != c; c = p.peek() {
+		p.next()
+	}
+	v := strings.TrimSpace(p.s[start:p.pos])
+	switch {
+	case "" == v:
+		return "", p.errorf("expected a value")
+	case "true" == v || "false" == v:
+		return v, nil
+	case strings.ContainsAny(v[:1], "0123456789+-") ||
+		"inf" == v || "nan" == v:
+		if strings.Contains(v, ":") || strings.Count(v, "-") > 1 {
+			return v, nil /* A date or time */
+		}
+		if !strings.ContainsAny(v, " \t") {
+			return strings.Replace(v, "_", "", -1), nil
+		}
+	}
+	return "", p.errorf("invalid value %q", v)
+}
+
+/* parseArray parses an array, returning its elements joined by commas */
+func (p *tomlParser) parseArray() (string, error) {
+	p.next()
+	var vs []string
+	for {
+		p.skipSpace(true)
+		if ']' == p.peek() {
+			p.next()
+			return strings.Join(vs, ","), nil
+		}
+		v, err := p.parseScalar()
+		if nil != err {
+			return "", err
+		}
+		vs = append(vs, v)
+		p.skipSpace(true)
+		switch p.next() {
+		case ',':
+		case ']':
+			return strings.Join(vs, ","), nil
+		default:
+			return "", p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+/* parseString parses any of TOML's four kinds of string */
+func (p *tomlParser) parseString() (string, error) {
+	q := p.peek()
+	triple := strings.Repeat(string(q), 3)
+	multi := strings.HasPrefix(p.s[p.pos:], triple)
+	if multi {
+		p.pos += 3
+		/* A newline right after the quotes is ignored */
+		if strings.HasPrefix(p.s[p.pos:], "\r\n") {
+			p.next()
+		}
+		if '\n' == p.peek() {
+			p.next()
+		}
+	} else {
+		p.next()
+	}
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", p.errorf("unterminated string")
+		}
+		/* Up to two quotes may come before the closing three */
+		if multi && strings.HasPrefix(p.s[p.pos:], triple) {
+			for n := countPrefix(p.s[p.pos:], q); n > 3; n-- {
+				b.WriteByte(p.next())
+			}
+			p.pos += 3
+			return b.String(), nil
+		}
+		if '\n' == p.peek() && !multi {
+			return "", p.errorf("newline in string")
+		}
+		c := p.next()
+		switch {
+		case q == c && !multi:
+			return b.String(), nil
+		case '\\' == c && '"' == q:
+			if err := p.parseEscape(&b, multi); nil != err {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+/* countPrefix returns the number of times c is repeated at the start of s */
+func countPrefix(s string, c byte) int {
+	n := 0
+	for n < len(s) && c == s[n] {
+		n++
+	}
+	return n
+}
+
+/* parseEscape parses the escape sequence after a \ in a basic string */
+func (p *tomlParser) parseEscape(b *strings.Builder, multi bool) error {
+	c := p.next()
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if 'U' == c {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return p.errorf("short unicode escape")
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if nil != err {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += n
+		b.WriteRune(rune(r))
+	case ' ', '\t', '\r', '\n':
+		/* A \ at the end of a line in a multi-line string trims
+		whitespace up to the next non-whitespace character */
+		if !multi {
+			return p.errorf("invalid escape \\%c", c)
+		}
+		for strings.ContainsRune(" \t\r\n", rune(p.peek())) &&
+			0 != p.peek() {
+			p.next()
+		}
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
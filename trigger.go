@@ -0,0 +1,93 @@
+package confflags
+
+import (
+	"sync"
+	"time"
+)
+
+/* How often the trigger file is checked */
+var triggerPoll = time.Second
+
+/* Ways other than signals to ask for a reload */
+type triggerState struct {
+	reloadRequests chan struct{}
+	triggerFile    string
+	triggerLock    sync.Mutex
+}
+
+func (s *triggerState) init() {
+	s.reloadRequests = make(chan struct{}, 1)
+}
+
+// TriggerReload asks for the config to be re-read as if a reload signal had
+// been caught, and returns without waiting for it.  The UpdateResult is sent
+// on the channel passed to Parse.  This is meant for platforms without
+// SIGHUP, e.g. from a Windows service's handler for a parameter change
+// request; Reload can be used instead to wait for the result.
+func TriggerReload() {
+	std.TriggerReload()
+}
+
+// TriggerReload asks for cf's config to be re-read.  See the package-level
+// TriggerReload.
+func (cf *ConfFlags) TriggerReload() {
+	select {
+	case cf.reloadRequests <- struct{}{}:
+	default: /* One's already waiting */
+	}
+}
+
+// SetReloadTrigger causes the config to be re-read, as with TriggerReload,
+// whenever the file at path is created or modified, so other processes can
+// ask for a reload on platforms without signals, e.g. with the
+// confflags-reload command, which modifies the file.  The file is checked
+// every second.  An empty path stops checking.
+func SetReloadTrigger(path string) {
+	std.SetReloadTrigger(path)
+}
+
+// SetReloadTrigger sets the file which causes cf's config to be re-read when
+// modified.  See the package-level SetReloadTrigger.
+func (cf *ConfFlags) SetReloadTrigger(path string) {
+	cf.triggerLock.Lock()
+	cf.triggerFile = path
+	cf.triggerLock.Unlock()
+	/* Wake up watchTrigger */
+	cf.cond.L.Lock()
+	defer cf.cond.L.Unlock()
+	cf.cond.Broadcast()
+}
+
+/* reloadTrigger returns the trigger file, if there is one */
+func (cf *ConfFlags) reloadTrigger() string {
+	cf.triggerLock.Lock()
+	defer cf.triggerLock.Unlock()
+	return cf.triggerFile
+}
+
+// watchTrigger calls TriggerReload when the trigger file changes, until cf is
+// shut down
+func (cf *ConfFlags) watchTrigger() {
+	for {
+		path := cf.reloadTrigger()
+		last := stampFile(path)
+		for "" != path {
+			if !cf.sleepUnlessStopped(triggerPoll) {
+				return
+			}
+			/* A new file starts afresh */
+			if p := cf.reloadTrigger(); p != path {
+				path, last = p, stampFile(p)
+				continue
+			}
+			if s := stampFile(path); !s.same(last) {
+				last = s
+				cf.TriggerReload()
+			}
+		}
+		/* Wait to be woke up */
+		if !cf.waitForChange() {
+			return
+		}
+	}
+}
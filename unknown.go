@@ -0,0 +1,163 @@
+package confflags
+
+import (
+	"fmt"
+	"sync"
+)
+
+// UnknownKeyMode says what's done with keys in the config file which aren't
+// the names of flags, e.g. in a config file shared by several programs.
+type UnknownKeyMode int
+
+const (
+	// UnknownKeyError makes an unknown key an error, so the config isn't
+	// applied.  This is the default.
+	UnknownKeyError UnknownKeyMode = iota
+	// UnknownKeyWarn ignores unknown keys, with a Warning for each.
+	UnknownKeyWarn
+	// UnknownKeyCollect keeps unknown keys and their values, which are
+	// returned by Extras.
+	UnknownKeyCollect
+)
+
+/* What's done with unknown keys, and the ones kept */
+type unknownState struct {
+	unknownKeyMode UnknownKeyMode
+	unknownHandler func(key, value, file string, line int)
+	extras         map[string]string
+	unknownLock    sync.Mutex
+}
+
+// SetUnknownKeyMode sets what's done with keys in the config file which
+// aren't the names of flags.  The default is UnknownKeyError.
+func SetUnknownKeyMode(m UnknownKeyMode) {
+	std.SetUnknownKeyMode(m)
+}
+
+// SetUnknownKeyMode sets what's done with keys in cf's config file which
+// aren't the names of flags.  See the package-level SetUnknownKeyMode.
+func (cf *ConfFlags) SetUnknownKeyMode(m UnknownKeyMode) {
+	cf.unknownLock.Lock()
+	cf.unknownKeyMode = m
+	cf.unknownLock.Unlock()
+	/* The config should be read again in the new mode */
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.lastDeps = nil
+}
+
+// OnUnknownKey causes fn to be called with each key in the config file which
+// isn't the name of a flag, with its value and where it was found, e.g. to
+// log them, count them, or pass them to a plugin.  Unknown keys passed to fn
+// aren't errors, whatever the UnknownKeyMode, but are still warned about or
+// collected in those modes.  fn is called synchronously once the rest of the
+// config has been applied, so it mustn't cause the config to be re-read.
+// A nil fn removes the handler.
+func OnUnknownKey(fn func(key, value, file string, line int)) {
+	std.OnUnknownKey(fn)
+}
+
+// OnUnknownKey causes fn to be called with each key in cf's config file
+// which isn't the name of a flag.  See the package-level OnUnknownKey.
+func (cf *ConfFlags) OnUnknownKey(fn func(key, value, file string,
+	line int)) {
+	cf.unknownLock.Lock()
+	cf.unknownHandler = fn
+	cf.unknownLock.Unlock()
+	/* The config should be read again to find the keys */
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.lastDeps = nil
+}
+
+// Extras returns a copy of the keys in the config file which aren't the
+// names of flags, with their values, if the UnknownKeyMode is
+// UnknownKeyCollect.
+func Extras() map[string]string {
+	return std.Extras()
+}
+
+// Extras returns a copy of the keys in cf's config file which aren't the
+// names of flags.  See the package-level Extras.
+func (cf *ConfFlags) Extras() map[string]string {
+	cf.unknownLock.Lock()
+	defer cf.unknownLock.Unlock()
+	e := make(map[string]string)
+	for k, v := range cf.extras {
+		e[k] = v
+	}
+	return e
+}
+
+// GetExtra returns the value of a key in the config file which isn't the name
+// of a flag, e.g. a long template which would be awkward on the command line,
+// and whether there was such a key.  Such keys are only kept if the
+// UnknownKeyMode is UnknownKeyCollect.
+func GetExtra(key string) (string, bool) {
+	return std.GetExtra(key)
+}
+
+// GetExtra returns the value of a key in cf's config file which isn't the
+// name of a flag.  See the package-level GetExtra.
+func (cf *ConfFlags) GetExtra(key string) (string, bool) {
+	cf.unknownLock.Lock()
+	defer cf.unknownLock.Unlock()
+	v, ok := cf.extras[key]
+	return v, ok
+}
+
+/* unknownKeysOK reports whether unknown keys aren't errors */
+func (s *unknownState) unknownKeysOK() bool {
+	s.unknownLock.Lock()
+	defer s.unknownLock.Unlock()
+	return UnknownKeyError != s.unknownKeyMode || nil != s.unknownHandler
+}
+
+// unknownKey handles arg, whose key isn't a flag, returning an error if
+// unknown keys are errors, or any warnings about it.  In UnknownKeyCollect
+// mode, it's added to extras.
+func (s *unknownState) unknownKey(arg Arg,
+	extras map[string]string) ([]Warning, error) {
+	s.unknownLock.Lock()
+	m, h := s.unknownKeyMode, s.unknownHandler
+	s.unknownLock.Unlock()
+	switch m {
+	case UnknownKeyWarn:
+		return []Warning{{arg, fmt.Sprintf("unknown \"%v\"",
+			arg.Key)}}, nil
+	case UnknownKeyCollect:
+		extras[arg.Key] = arg.Value
+		return nil, nil
+	}
+	if nil != h {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown \"%v\" in %v", arg.Key,
+		arg.location())
+}
+
+/* handleUnknown passes the Args in unknown to the OnUnknownKey handler */
+func (s *unknownState) handleUnknown(unknown []Arg) {
+	s.unknownLock.Lock()
+	h := s.unknownHandler
+	s.unknownLock.Unlock()
+	if nil == h {
+		return
+	}
+	for _, arg := range unknown {
+		h(arg.Key, arg.Value, arg.FilePath, arg.LineNum)
+	}
+}
+
+// setExtras notes the unknown keys collected from the config.  Unless
+// replace is true, they're added to those already noted.
+func (s *unknownState) setExtras(extras map[string]string, replace bool) {
+	s.unknownLock.Lock()
+	defer s.unknownLock.Unlock()
+	if replace || nil == s.extras {
+		s.extras = make(map[string]string)
+	}
+	for k, v := range extras {
+		s.extras[k] = v
+	}
+}
@@ -0,0 +1,37 @@
+package confflags
+
+/* Checks of the flags as a whole, guarded by updateLock */
+type validateState struct {
+	validators []func(snapshot map[string]string) error
+}
+
+// RegisterValidator causes fn to be called with the value of every flag,
+// by name, whenever the config is read, once the new values have been
+// worked out but before any flag is set.  If fn returns an error,
+// none of the new values are applied and the error is returned from Parse
+// or in the UpdateResult.  This allows checks which involve more than one
+// flag, e.g. that -minWorkers is no more than -maxWorkers.
+func RegisterValidator(fn func(snapshot map[string]string) error) {
+	std.RegisterValidator(fn)
+}
+
+// RegisterValidator causes fn to be called with the value of every flag in
+// cf's FlagSet whenever the config is read.  See the package-level
+// RegisterValidator.
+func (cf *ConfFlags) RegisterValidator(fn func(
+	snapshot map[string]string) error) {
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.validators = append(cf.validators, fn)
+}
+
+// validate calls the validators with snapshot, the value of every flag as it
+// will be if the new config is applied
+func (cf *ConfFlags) validate(snapshot map[string]string) error {
+	for _, fn := range cf.validators {
+		if err := fn(snapshot); nil != err {
+			return err
+		}
+	}
+	return nil
+}
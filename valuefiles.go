@@ -0,0 +1,42 @@
+package confflags
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// valueFile returns the file named by a's value, if it's of the form @path,
+// e.g. @/run/secrets/db_password.  A relative path is relative to the
+// directory of the config file in which a appeared.  A value starting with
+// @@ doesn't name a file.
+func valueFile(a Arg) (string, bool) {
+	if !strings.HasPrefix(a.Value, "@") ||
+		strings.HasPrefix(a.Value, "@@") || 1 == len(a.Value) {
+		return "", false
+	}
+	path := a.Value[1:]
+	if !filepath.IsAbs(path) && 0 != a.LineNum &&
+		!isSourceURL(a.FilePath) {
+		path = filepath.Join(filepath.Dir(a.FilePath), path)
+	}
+	return path, true
+}
+
+// fileValue returns a's value, or, if it names a file, the file's contents
+// with leading and trailing whitespace removed.  A leading @@ is unescaped
+// to @.
+func fileValue(a Arg) (string, error) {
+	if strings.HasPrefix(a.Value, "@@") {
+		return a.Value[1:], nil
+	}
+	path, ok := valueFile(a)
+	if !ok {
+		return a.Value, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if nil != err {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
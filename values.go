@@ -0,0 +1,235 @@
+package confflags
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StringSlice defines a flag in flag.CommandLine whose value is a list of
+// strings, with the given name, default value, and usage string.  The list
+// may be given as comma-separated values, by repeating the flag on the
+// command line, or by repeating the key in the config file, e.g.
+//
+//	-allow-ip 10.0.0.0/8,192.168.0.0/16
+//
+// or
+//
+//	allow-ip 10.0.0.0/8
+//	allow-ip 192.168.0.0/16
+//
+// Values given on the command line replace the default.  The return value is
+// the address of a []string variable which stores the flag's value.
+func StringSlice(name string, def []string, usage string) *[]string {
+	return std.StringSlice(name, def, usage)
+}
+
+// StringSlice defines a list-of-strings flag in cf's FlagSet.  See the
+// package-level StringSlice.
+func (cf *ConfFlags) StringSlice(name string, def []string,
+	usage string) *[]string {
+	p := append([]string(nil), def...)
+	cf.fs.Var(&stringSliceValue{p: &p}, name, usage)
+	return &p
+}
+
+// stringSliceValue is the value of a StringSlice flag.  It's an Appender, so
+// repeated keys in the config file add to the list.
+type stringSliceValue struct {
+	p   *[]string
+	set bool /* Set since the default, so Set adds to the list */
+}
+
+func (v *stringSliceValue) String() string {
+	if nil == v.p {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v *stringSliceValue) Set(s string) error {
+	if !v.set {
+		v.Reset()
+	}
+	return v.Append(s)
+}
+
+func (v *stringSliceValue) Reset() {
+	*v.p = nil
+	v.set = true
+}
+
+func (v *stringSliceValue) shadow() flag.Value {
+	return &stringSliceValue{p: new([]string)}
+}
+
+/* Append adds the comma-separated values in s to the list */
+func (v *stringSliceValue) Append(s string) error {
+	for _, e := range strings.Split(s, ",") {
+		if "" != e {
+			*v.p = append(*v.p, e)
+		}
+	}
+	return nil
+}
+
+// StringMap defines a flag in flag.CommandLine whose value is a map of
+// strings to strings, with the given name and usage string.  Entries are
+// given as key=value, and may be comma-separated, repeated on the command
+// line, or repeated in the config file, e.g.
+//
+//	-tag env=prod -tag team=core
+//
+// The returned StringMapValue may be read while the config is re-read, and
+// OnFlagChange may be used to find out when it changes.
+func StringMap(name, usage string) *StringMapValue {
+	return std.StringMap(name, usage)
+}
+
+// StringMap defines a map-of-strings flag in cf's FlagSet.  See the
+// package-level StringMap.
+func (cf *ConfFlags) StringMap(name, usage string) *StringMapValue {
+	v := &StringMapValue{}
+	cf.fs.Var(v, name, usage)
+	return v
+}
+
+// StringMapValue is the value of a StringMap flag.  It's an Appender, so
+// repeated keys in the config file add to the map.  It's safe for
+// concurrent use.
+type StringMapValue struct {
+	m    map[string]string
+	lock sync.Mutex
+}
+
+// Get returns the value for key in the map, and whether there is one.
+func (v *StringMapValue) Get(key string) (string, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	s, ok := v.m[key]
+	return s, ok
+}
+
+// Map returns a copy of the map.
+func (v *StringMapValue) Map() map[string]string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	m := make(map[string]string, len(v.m))
+	for k, s := range v.m {
+		m[k] = s
+	}
+	return m
+}
+
+// String returns the entries as comma-separated key=value pairs, sorted by
+// key.
+func (v *StringMapValue) String() string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	keys := make([]string, 0, len(v.m))
+	for k := range v.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + v.m[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set adds the comma-separated key=value pairs in s to the map.
+func (v *StringMapValue) Set(s string) error {
+	return v.Append(s)
+}
+
+// Reset empties the map.
+func (v *StringMapValue) Reset() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.m = nil
+}
+
+func (v *StringMapValue) shadow() flag.Value {
+	return &StringMapValue{}
+}
+
+// Append adds the comma-separated key=value pairs in s to the map.
+func (v *StringMapValue) Append(s string) error {
+	m := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		if "" == p {
+			continue
+		}
+		i := strings.Index(p, "=")
+		if 0 >= i {
+			return fmt.Errorf("expected key=value, not %q", p)
+		}
+		m[p[:i]] = p[i+1:]
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if nil == v.m {
+		v.m = make(map[string]string)
+	}
+	for k, s := range m {
+		v.m[k] = s
+	}
+	return nil
+}
+
+// Enum defines a string flag in flag.CommandLine with the given name,
+// default value, and usage string, which may only be set to one of the
+// allowed values or the default.  Other values are rejected on the command
+// line and in the config file, when it's first read and when it's re-read.
+// The allowed values are listed after the usage string.  The return value
+// is the address of a string variable which stores the flag's value.
+func Enum(name, def, usage string, allowed ...string) *string {
+	return std.Enum(name, def, usage, allowed...)
+}
+
+// Enum defines a string flag in cf's FlagSet which may only be set to one
+// of the allowed values or the default.  See the package-level Enum.
+func (cf *ConfFlags) Enum(name, def, usage string,
+	allowed ...string) *string {
+	p := def
+	cf.fs.Var(&enumValue{p: &p, def: def, allowed: allowed}, name,
+		fmt.Sprintf("%v (one of %v)", usage, strings.Join(allowed,
+			", ")))
+	return &p
+}
+
+/* enumValue is the value of an Enum flag */
+type enumValue struct {
+	p       *string
+	def     string
+	allowed []string
+}
+
+func (v *enumValue) String() string {
+	if nil == v.p {
+		return ""
+	}
+	return *v.p
+}
+
+func (v *enumValue) Set(s string) error {
+	if s == v.def {
+		*v.p = s
+		return nil
+	}
+	for _, a := range v.allowed {
+		if s == a {
+			*v.p = s
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %v", s,
+		strings.Join(v.allowed, ", "))
+}
+
+func (v *enumValue) shadow() flag.Value {
+	return &enumValue{p: new(string), def: v.def, allowed: v.allowed}
+}
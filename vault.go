@@ -0,0 +1,183 @@
+package confflags
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault is reached with its HTTP API at VAULT_ADDR, by default
+// https://127.0.0.1:8200, with the token in VAULT_TOKEN or ~/.vault-token and
+// the namespace, if any, in VAULT_NAMESPACE.
+
+/* vaultSecret is a secret read from Vault, kept until its lease runs low */
+type vaultSecret struct {
+	data      map[string]json.RawMessage
+	leaseID   string
+	renewable bool
+	lease     time.Duration
+	refresh   time.Time /* When to renew or re-read it */
+}
+
+/* Secrets with leases, by path */
+var (
+	vaultSecrets = make(map[string]*vaultSecret)
+	vaultLock    sync.Mutex
+)
+
+// resolveVault returns the value of a key in a secret in Vault.  ref is the
+// secret's path and the key, e.g. secret/data/app#password.  Both KV version
+// 1 and 2 secrets may be read, as may dynamic secrets such as database
+// credentials.  A secret with a lease is kept until two thirds of the lease
+// has passed, so every key is from the same secret, and is then renewed if
+// possible or else read again.  The returned duration is the time until
+// then.
+func resolveVault(ref string) (string, time.Duration, error) {
+	i := strings.LastIndex(ref, "#")
+	if -1 == i {
+		return "", 0, fmt.Errorf("no #key in vault:%v", ref)
+	}
+	path, key := strings.Trim(ref[:i], "/"), ref[i+1:]
+
+	vaultLock.Lock()
+	defer vaultLock.Unlock()
+	s, err := vaultSecretFor(path)
+	if nil != err {
+		return "", 0, err
+	}
+	var ttl time.Duration
+	if !s.refresh.IsZero() {
+		ttl = s.refresh.Sub(now())
+	}
+	raw, ok := s.data[key]
+	if !ok {
+		return "", 0, fmt.Errorf("vault secret %v has no key %v", path,
+			key)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); nil == err {
+		return v, ttl, nil
+	}
+	return string(raw), ttl, nil
+}
+
+// vaultSecretFor returns the secret at path, from the cache if its lease
+// isn't running low.  vaultLock must be held.
+func vaultSecretFor(path string) (*vaultSecret, error) {
+	s, ok := vaultSecrets[path]
+	if ok && now().Before(s.refresh) {
+		return s, nil
+	}
+	/* Try to keep the secret we have */
+	if ok && s.renewable {
+		d, err := vaultRenew(s)
+		if nil == err && d >= s.lease/3 {
+			s.refresh = now().Add(2 * d / 3)
+			return s, nil
+		}
+	}
+	delete(vaultSecrets, path)
+
+	/* Get a new one */
+	var res struct {
+		LeaseID       string                     `json:"lease_id"`
+		Renewable     bool                       `json:"renewable"`
+		LeaseDuration int64                      `json:"lease_duration"`
+		Data          map[string]json.RawMessage `json:"data"`
+	}
+	if err := vaultRequest(http.MethodGet, "/v1/"+path, nil,
+		&res); nil != err {
+		return nil, err
+	}
+	s = &vaultSecret{
+		data:      res.Data,
+		leaseID:   res.LeaseID,
+		renewable: res.Renewable,
+		lease:     time.Duration(res.LeaseDuration) * time.Second,
+	}
+	/* KV version 2 secrets are wrapped in metadata */
+	if d, ok := res.Data["data"]; ok {
+		if _, ok := res.Data["metadata"]; ok {
+			s.data = nil
+			if err := json.Unmarshal(d, &s.data); nil != err {
+				return nil, fmt.Errorf("unable to decode vault "+
+					"secret %v: %v", path, err)
+			}
+		}
+	}
+	if 0 != s.lease {
+		s.refresh = now().Add(2 * s.lease / 3)
+		vaultSecrets[path] = s
+	}
+	return s, nil
+}
+
+/* vaultRenew renews s's lease, returning the new lease duration */
+func vaultRenew(s *vaultSecret) (time.Duration, error) {
+	var res struct {
+		LeaseDuration int64 `json:"lease_duration"`
+	}
+	if err := vaultRequest(http.MethodPut, "/v1/sys/leases/renew",
+		map[string]string{"lease_id": s.leaseID}, &res); nil != err {
+		return 0, err
+	}
+	return time.Duration(res.LeaseDuration) * time.Second, nil
+}
+
+/* vaultRequest makes a request to Vault, decoding the response into res */
+func vaultRequest(method, path string, req, res interface{}) error {
+	addr := os.Getenv("VAULT_ADDR")
+	if "" == addr {
+		addr = "https://127.0.0.1:8200"
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if "" == token {
+		if home, err := os.UserHomeDir(); nil == err {
+			b, _ := ioutil.ReadFile(filepath.Join(home,
+				".vault-token"))
+			token = strings.TrimSpace(string(b))
+		}
+	}
+	var body bytes.Buffer
+	if nil != req {
+		if err := json.NewEncoder(&body).Encode(req); nil != err {
+			return err
+		}
+	}
+	hr, err := http.NewRequest(method, strings.TrimRight(addr, "/")+path,
+		&body)
+	if nil != err {
+		return err
+	}
+	if "" != token {
+		hr.Header.Set("X-Vault-Token", token)
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); "" != ns {
+		hr.Header.Set("X-Vault-Namespace", ns)
+	}
+	r, err := HTTPClient.Do(hr)
+	if nil != err {
+		return err
+	}
+	defer r.Body.Close()
+	b, err := ioutil.ReadAll(r.Body)
+	if nil != err {
+		return err
+	}
+	if http.StatusOK != r.StatusCode {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(b, &e)
+		return fmt.Errorf("vault %v %v failed: %v %v", method, path,
+			r.Status, strings.Join(e.Errors, "; "))
+	}
+	return json.Unmarshal(b, res)
+}
@@ -0,0 +1,103 @@
+package confflags
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Warning describes a problem with a line in the config file which isn't
+// serious enough to stop the config from being used, such as a key which is
+// set more than once.
+type Warning struct {
+	Arg        /* The line in the config file */
+	Msg string /* What's wrong with it */
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%v in %v", w.Msg, w.location())
+}
+
+/* Where warnings go */
+type warningState struct {
+	warningChan chan Warning
+	warned      map[Warning]bool /* Sent about the config as it is */
+	warningLock sync.Mutex
+}
+
+// SetWarningChan sets the channel on which warnings found while reading the
+// config file are sent.  Warnings are discarded if the channel is nil, which
+// is the default.  Sends don't block, so c should be buffered; warnings
+// which don't fit are dropped.  A warning about the config file is sent once,
+// not every time the file is re-read, unless it goes away and comes back.
+func SetWarningChan(c chan Warning) {
+	std.SetWarningChan(c)
+}
+
+// SetWarningChan sets the channel on which warnings found while reading cf's
+// config file are sent.  See the package-level SetWarningChan.
+func (cf *ConfFlags) SetWarningChan(c chan Warning) {
+	cf.warningLock.Lock()
+	defer cf.warningLock.Unlock()
+	cf.warningChan = c
+}
+
+// warn sends ws, in order, on the warning channel, dropping those which
+// don't fit
+func (s *warningState) warn(ws []Warning) {
+	s.warningLock.Lock()
+	c := s.warningChan
+	s.warningLock.Unlock()
+	if nil == c {
+		return
+	}
+	for _, w := range ws {
+		select {
+		case c <- w:
+		default:
+		}
+	}
+}
+
+// warnConfig sends the warnings in ws which weren't found the last time the
+// config was read.  If replace is true, the config was read in full, and
+// warnings not in ws have gone away.
+func (s *warningState) warnConfig(ws []Warning, replace bool) {
+	s.warningLock.Lock()
+	var fresh []Warning
+	for _, w := range ws {
+		if !s.warned[w] {
+			fresh = append(fresh, w)
+		}
+	}
+	if replace || nil == s.warned {
+		s.warned = make(map[Warning]bool)
+	}
+	for _, w := range ws {
+		s.warned[w] = true
+	}
+	s.warningLock.Unlock()
+	s.warn(fresh)
+}
+
+// dedupeArgs returns the last Arg for each key in args, in the order in
+// which they appear, with warnings about the ones which were dropped.
+func dedupeArgs(args []Arg) ([]Arg, []Warning) {
+	last := make(map[string]int)
+	for i, arg := range args {
+		last[arg.Key] = i
+	}
+	var (
+		out []Arg
+		ws  []Warning
+	)
+	for i, arg := range args {
+		if l := last[arg.Key]; l != i {
+			ws = append(ws, Warning{arg, fmt.Sprintf(
+				"%v overridden by %v", arg.Key,
+				args[l].location())})
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out, ws
+}
@@ -0,0 +1,74 @@
+package confflags
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const configWatchIntervalUsage = "Interval at which to check the files " +
+	"given with -config for changes and re-read them if they've " +
+	"changed.  Symlinks are followed, so Kubernetes ConfigMap " +
+	"updates are noticed.  Zero disables checking."
+
+// fileStamp identifies the version of a file seen when checking for
+// changes.  Replacing a file by renaming another over it or by changing a
+// symlink in its path, as Kubernetes does when updating a ConfigMap, gives
+// it a new stamp even if its size and modification time are the same.
+type fileStamp struct {
+	resolved string      /* Path with symlinks resolved */
+	info     os.FileInfo /* nil if the file doesn't exist */
+}
+
+/* stampFile returns the current stamp for the file at path */
+func stampFile(path string) fileStamp {
+	var s fileStamp
+	r, err := filepath.EvalSymlinks(path)
+	if nil != err {
+		return s
+	}
+	s.resolved = r
+	s.info, _ = os.Stat(r)
+	return s
+}
+
+/* same reports whether s and o are stamps of the same version of a file */
+func (s fileStamp) same(o fileStamp) bool {
+	if nil == s.info || nil == o.info {
+		return nil == s.info && nil == o.info
+	}
+	return s.resolved == o.resolved && os.SameFile(s.info, o.info) &&
+		s.info.Size() == o.info.Size() &&
+		s.info.ModTime().Equal(o.info.ModTime())
+}
+
+// configStamps returns stamps for the local files given with -config or
+// found with the search paths.  URLs for Sources are skipped.
+func (cf *ConfFlags) configStamps() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, path := range cf.configPaths() {
+		if isSourceURL(path) {
+			continue
+		}
+		stamps[path] = stampFile(path)
+	}
+	return stamps
+}
+
+// configChanged reports whether the config files' stamps differ from last,
+// which is updated
+func (cf *ConfFlags) configChanged(last map[string]fileStamp) bool {
+	now := cf.configStamps()
+	changed := len(now) != len(last)
+	for path, s := range now {
+		if o, ok := last[path]; !ok || !s.same(o) {
+			changed = true
+		}
+	}
+	for path := range last {
+		delete(last, path)
+	}
+	for path, s := range now {
+		last[path] = s
+	}
+	return changed
+}
@@ -0,0 +1,91 @@
+package confflags
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+/* webhookPayload is what's sent to webhooks */
+type webhookPayload struct {
+	Program    string            `json:"program"`
+	Host       string            `json:"host"`
+	Time       time.Time         `json:"time"`
+	Generation int               `json:"generation"`
+	Changed    map[string]string `json:"changed,omitempty"`
+	Old        map[string]string `json:"old,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// AddWebhook causes every UpdateResult with changes or an error to be POSTed
+// as JSON to the http or https URL u, so other systems can learn about config
+// changes.  Values of Secret flags are replaced with *****.  Failed requests
+// are retried with exponential backoff, starting at one second, up to a
+// total of attempts tries.  Requests are made in the background.
+func AddWebhook(u string, attempts int) error {
+	return std.AddWebhook(u, attempts)
+}
+
+// AddWebhook causes every UpdateResult from cf with changes or an error to
+// be POSTed as JSON to u.  See the package-level AddWebhook.
+func (cf *ConfFlags) AddWebhook(u string, attempts int) error {
+	pu, err := url.Parse(u)
+	if nil != err {
+		return err
+	}
+	if "http" != pu.Scheme && "https" != pu.Scheme {
+		return fmt.Errorf("webhook URL %v is not http or https", u)
+	}
+	cf.updateLock.Lock()
+	defer cf.updateLock.Unlock()
+	cf.updateHooks = append(cf.updateHooks, func(res UpdateResult) {
+		p := cf.newWebhookPayload(res)
+		go postWebhook(u, p, attempts)
+	})
+	return nil
+}
+
+/* newWebhookPayload makes the payload for res */
+func (cf *ConfFlags) newWebhookPayload(res UpdateResult) webhookPayload {
+	host, _ := os.Hostname()
+	p := webhookPayload{
+		Program:    os.Args[0],
+		Host:       host,
+		Time:       now(),
+		Generation: cf.Generation(),
+		Changed:    cf.redactValues(res.ChangedFlags),
+		Old:        cf.redactValues(res.OldValues),
+	}
+	if nil != res.Err {
+		p.Error = res.Err.Error()
+	}
+	return p
+}
+
+/* postWebhook POSTs p to u, trying up to attempts times */
+func postWebhook(u string, p webhookPayload, attempts int) {
+	b, err := json.Marshal(p)
+	if nil != err {
+		return
+	}
+	c := &http.Client{Timeout: 30 * time.Second}
+	wait := time.Second
+	for i := 0; i < attempts; i++ {
+		if 0 != i {
+			sleep(wait)
+			wait *= 2
+		}
+		res, err := c.Post(u, "application/json", bytes.NewReader(b))
+		if nil != err {
+			continue
+		}
+		res.Body.Close()
+		if 2 == res.StatusCode/100 {
+			return
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package confflags
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlFormat reads and writes YAML.  Nested mappings are flattened to
+// dot-separated flag names, so
+//
+//	http:
+//	  port: 8080
+//
+// sets -http.port.  Sequences are joined with commas.  Only the first
+// document is read, and anchors, aliases, tags, and mappings inside
+// sequences aren't supported.
+type yamlFormat struct{}
+
+func (yamlFormat) Read(rd io.Reader, name string) ([]Arg, error) {
+	b, err := ioutil.ReadAll(rd)
+	if nil != err {
+		return nil, err
+	}
+	p := &yamlParser{
+		lines: strings.Split(strings.Replace(string(b), "\r\n", "\n",
+			-1), "\n"),
+		name: name,
+	}
+	if err := p.parseDocument(); nil != err {
+		return nil, err
+	}
+	return p.args, nil
+}
+
+func (yamlFormat) Write(w io.Writer, args []Arg) error {
+	for _, arg := range args {
+		k := arg.Key
+		if -1 != strings.IndexFunc(k, func(r rune) bool {
+			return r > 0x7f || !isTOMLBare(byte(r)) && '.' != r
+		}) || "" == k {
+			k = strconv.Quote(k)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s\n", k,
+			strconv.Quote(arg.Value)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+/* yamlParser holds the state of a YAML document being parsed */
+type yamlParser struct {
+	lines []string /* The document */
+	i     int      /* Index in lines of the next line */
+	name  string   /* File name, for Args and errors */
+	args  []Arg
+}
+
+/* errorf returns an error noting the line before the next one */
+func (p *yamlParser) errorf(f string, a ...interface{}) error {
+	return fmt.Errorf("%v in line %v of %v", fmt.Sprintf(f, a...), p.i,
+		p.name)
+}
+
+/* skip skips blank lines and comments */
+func (p *yamlParser) skip() {
+	for p.i < len(p.lines) {
+		l := strings.TrimSpace(p.lines[p.i])
+		if "" != l && !strings.HasPrefix(l, "#") {
+			return
+		}
+		p.i++
+	}
+}
+
+/* done reports whether the end of the document has been reached */
+func (p *yamlParser) done() bool {
+	if p.i >= len(p.lines) {
+		return true
+	}
+	l := strings.TrimRight(p.lines[p.i], " \t")
+	return "---" == l || "..." == l
+}
+
+/* indent returns the indentation of the next line */
+func (p *yamlParser) indent() int {
+	return len(p.lines[p.i]) - len(strings.TrimLeft(p.lines[p.i], " "))
+}
+
+/* text returns the next line without indentation or trailing space */
+func (p *yamlParser) text() string {
+	return strings.TrimSpace(p.lines[p.i])
+}
+
+/* parseDocument parses the first document into p.args */
+func (p *yamlParser) parseDocument() error {
+	p.skip()
+	if p.i < len(p.lines) && "---" == strings.TrimSpace(p.lines[p.i]) {
+		p.i++
+		p.skip()
+	}
+	if p.done() {
+		return nil
+	}
+	if err := p.parseMapping(p.indent(), ""); nil != err {
+		return err
+	}
+	if !p.done() {
+		p.i++
+		return p.errorf("unexpected indentation")
+	}
+	return nil
+}
+
+/* isYAMLSeqItem reports whether l is a sequence item */
+func isYAMLSeqItem(l string) bool {
+	return "-" == l || strings.HasPrefix(l, "- ")
+}
+
+/* parseMapping parses a block mapping whose keys are under prefix */
+func (p *yamlParser) parseMapping(indent int, prefix string) error {
+	for {
+		p.skip()
+		if p.done() || p.indent() < indent {
+			return nil
+		}
+		if p.indent() > indent {
+			p.i++
+			return p.errorf("unexpected indentation")
+		}
+		if strings.HasPrefix(p.lines[p.i], "\t") {
+			p.i++
+			return p.errorf("tab in indentation")
+		}
+		line := p.text()
+		p.i++
+		lineNum := p.i
+		if isYAMLSeqItem(line) {
+			return p.errorf("expected a key")
+		}
+		key, rest, err := splitYAMLKey(line)
+		if nil != err {
+			return p.errorf("%v", err)
+		}
+		key = prefix + key
+		var v string
+		switch {
+		case "" == rest:
+			/* Either a nested block or nothing */
+			p.skip()
+			if p.done() {
+				break
+			}
+			ni, t := p.indent(), p.text()
+			switch {
+			case isYAMLSeqItem(t) && ni >= indent:
+				if v, err = p.parseSequence(ni); nil != err {
+					return err
+				}
+			case ni > indent:
+				if err := p.parseMapping(ni,
+					key+"."); nil != err {
+					return err
+				}
+				continue
+			}
+		case '|' == rest[0] || '>' == rest[0]:
+			v = p.parseBlockScalar(indent, rest)
+		case '{' == rest[0]:
+			if err := p.parseFlowMapping(rest, key+".",
+				lineNum); nil != err {
+				return err
+			}
+			continue
+		default:
+			if v, err = parseYAMLScalar(rest); nil != err {
+				return p.errorf("%v", err)
+			}
+		}
+		p.args = append(p.args, Arg{
+			Key:      key,
+			Value:    v,
+			FilePath: p.name,
+			LineNum:  lineNum,
+		})
+	}
+}
+
+// splitYAMLKey splits a line of a mapping into its key and the rest of the
+// line, without any comment
+func splitYAMLKey(line string) (key, rest string, err error) {
+	/* Quoted keys end with a quote */
+	if '"' == line[0] || '\'' == line[0] {
+		q, n, err := unquoteYAML(line)
+		if nil != err {
+			return "", "", err
+		}
+		line = line[n:]
+		if !strings.HasPrefix(line, ":") {
+			return "", "", fmt.Errorf("expected : after key")
+		}
+		key, rest = q, line[1:]
+	} else {
+		i := strings.Index(line, ": ")
+		if -1 == i {
+			if !strings.HasSuffix(line, ":") {
+				return "", "", fmt.Errorf("expected key: value")
+			}
+			i = len(line) - 1
+		}
+		key, rest = strings.TrimSpace(line[:i]), line[i+1:]
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return key, rest, nil
+}
+
+/* parseSequence parses a block sequence, joining its items with commas */
+func (p *yamlParser) parseSequence(indent int) (string, error) {
+	var vs []string
+	for {
+		p.skip()
+		if p.done() || indent != p.indent() || !isYAMLSeqItem(p.text()) {
+			return strings.Join(vs, ","), nil
+		}
+		item := strings.TrimSpace(p.text()[1:])
+		p.i++
+		if "" == item {
+			return "", p.errorf("nested blocks in sequences are " +
+				"not supported")
+		}
+		if _, _, err := splitYAMLKey(item); nil == err &&
+			!strings.ContainsAny(item[:1], `"'`) {
+			return "", p.errorf("mappings in sequences are not " +
+				"supported")
+		}
+		v, err := parseYAMLScalar(item)
+		if nil != err {
+			return "", p.errorf("%v", err)
+		}
+		vs = append(vs, v)
+	}
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar belonging
+// to a key indented by indent, with the given header
+func (p *yamlParser) parseBlockScalar(indent int, header string) string {
+	/* Gather the lines, which are indented more than the key */
+	var lines []string
+	contentIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		l := strings.TrimRight(p.lines[p.i], " \t")
+		if "" == l {
+			lines = append(lines, "")
+			continue
+		}
+		ind := len(l) - len(strings.TrimLeft(l, " "))
+		if ind <= indent {
+			break
+		}
+		if -1 == contentIndent {
+			contentIndent = ind
+		}
+		if ind < contentIndent {
+			ind = contentIndent
+		}
+		lines = append(lines, strings.Repeat(" ", ind-contentIndent)+
+			strings.TrimLeft(l, " "))
+	}
+	/* Trailing blank lines only matter for keep chomping */
+	n := len(lines)
+	for 0 < n && "" == lines[n-1] {
+		n--
+	}
+	trailing := len(lines) - n
+	lines = lines[:n]
+
+	/* Literal scalars keep newlines, folded ones mostly don't */
+	var v string
+	if '|' == header[0] {
+		v = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, l := range lines {
+			/* A blank line is a newline */
+			switch {
+			case "" == l:
+				b.WriteByte('\n')
+			case 0 != i && "" != lines[i-1]:
+				b.WriteByte(' ')
+			}
+			b.WriteString(l)
+		}
+		v = b.String()
+	}
+	switch {
+	case 0 == n:
+	case strings.Contains(header, "-"):
+	case strings.Contains(header, "+"):
+		v += strings.Repeat("\n", trailing+1)
+	default:
+		v += "\n"
+	}
+	return v
+}
+
+// parseFlowMapping parses a single-line flow mapping, e.g. {a: 1, b: 2},
+// whose keys are under prefix
+func (p *yamlParser) parseFlowMapping(s, prefix string, lineNum int) error {
+	items, err := splitYAMLFlow(s, '{', '}')
+	if nil != err {
+		return p.errorf("%v", err)
+	}
+	for _, item := range items {
+		k, v, err := splitYAMLKey(item)
+		if nil != err {
+			return p.errorf("%v", err)
+		}
+		if v, err = parseYAMLScalar(v); nil != err {
+			return p.errorf("%v", err)
+		}
+		p.args = append(p.args, Arg{
+			Key:      prefix + k,
+			Value:    v,
+			FilePath: p.name,
+			LineNum:  lineNum,
+		})
+	}
+	return nil
+}
+
+// splitYAMLFlow splits a single-line flow collection s, which starts with
+// open and ends with close, into its items
+func splitYAMLFlow(s string, open, close byte) ([]string, error) {
+	if open != s[0] {
+		return nil, fmt.Errorf("expected %c", open)
+	}
+	var (
+		items []string
+		start = 1
+	)
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			_, n, err := unquoteYAML(s[i:])
+			if nil != err {
+				return nil, err
+			}
+			i += n - 1
+		case '[', '{':
+			return nil, fmt.Errorf("nested collections are not " +
+				"supported")
+		case ',', close:
+			if item := strings.TrimSpace(s[start:i]); "" != item {
+				items = append(items, item)
+			}
+			start = i + 1
+			if close != s[i] {
+				continue
+			}
+			if rest := strings.TrimSpace(s[i+1:]); "" != rest &&
+				!strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("unexpected %q", rest)
+			}
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("missing %c", close)
+}
+
+/* parseYAMLScalar parses a scalar or flow sequence */
+func parseYAMLScalar(s string) (string, error) {
+	if "" == s {
+		return "", nil
+	}
+	switch s[0] {
+	case '"', '\'':
+		v, n, err := unquoteYAML(s)
+		if nil != err {
+			return "", err
+		}
+		if rest := strings.TrimSpace(s[n:]); "" != rest &&
+			!strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string",
+				rest)
+		}
+		return v, nil
+	case '[':
+		items, err := splitYAMLFlow(s, '[', ']')
+		if nil != err {
+			return "", err
+		}
+		for i, item := range items {
+			if items[i], err = parseYAMLScalar(item); nil != err {
+				return "", err
+			}
+		}
+		return strings.Join(items, ","), nil
+	case '{':
+		return "", fmt.Errorf("mappings in sequences are not supported")
+	case '&', '*', '!':
+		return "", fmt.Errorf("anchors, aliases, and tags are not " +
+			"supported")
+	}
+	/* Plain scalars end at a comment */
+	if i := strings.Index(s, " #"); -1 != i {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if "~" == s || "null" == s {
+		return "", nil
+	}
+	return s, nil
+}
+
+// unquoteYAML unquotes the single- or double-quoted string at the start of
+// s, returning it and the number of bytes of s it took up
+func unquoteYAML(s string) (string, int, error) {
+	q := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '\'' == q && '\'' == c:
+			/* '' is an escaped ' */
+			if i+1 < len(s) && '\'' == s[i+1] {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		case '"' == q && '"' == c:
+			return b.String(), i + 1, nil
+		case '"' == q && '\\' == c:
+			n, err := unescapeYAML(&b, s[i+1:])
+			if nil != err {
+				return "", 0, err
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// unescapeYAML writes the character for the escape sequence at the start of
+// s, which followed a \, to b, and returns the length of the sequence
+func unescapeYAML(b *strings.Builder, s string) (int, error) {
+	if "" == s {
+		return 0, fmt.Errorf("unterminated string")
+	}
+	if r, ok := map[byte]rune{'0': 0, 'a': '\a', 'b': '\b', 't': '\t',
+		'n': '\n', 'v': '\v', 'f': '\f', 'r': '\r', 'e': 0x1b, ' ': ' ',
+		'"': '"', '/': '/', '\\': '\\', 'N': 0x85, '_': 0xa0,
+		'L': 0x2028, 'P': 0x2029}[s[0]]; ok {
+		b.WriteRune(r)
+		return 1, nil
+	}
+	n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[0]]
+	if 0 == n || len(s) < n+1 {
+		return 0, fmt.Errorf("invalid escape \\%c", s[0])
+	}
+	r, err := strconv.ParseUint(s[1:n+1], 16, 32)
+	if nil != err || !utf8.ValidRune(rune(r)) {
+		return 0, fmt.Errorf("invalid escape \\%v", s[:n+1])
+	}
+	b.WriteRune(rune(r))
+	return n + 1, nil
+}